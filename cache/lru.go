@@ -0,0 +1,75 @@
+// Package cache holds results that are slow to work out but safe to lose.
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is a cache of up to a fixed number of entries, dropping the least
+// recently used first. It's safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[K]*list.Element
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New returns an LRU holding at most size entries.
+func New[K comparable, V any](size int) *LRU[K, V] {
+	return &LRU[K, V]{
+		size:  size,
+		order: list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value for k, if it's there.
+func (c *LRU[K, V]) Get(k K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[k]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*entry[K, V]).value, true
+}
+
+// Add stores v for k, evicting the least recently used entry if the cache
+// is full.
+func (c *LRU[K, V]) Add(k K, v V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[k]; ok {
+		e.Value.(*entry[K, V]).value = v
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.items[k] = c.order.PushFront(&entry[K, V]{key: k, value: v})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*entry[K, V]).key)
+	}
+}
+
+// Remove drops k, if it's there.
+func (c *LRU[K, V]) Remove(k K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[k]; ok {
+		c.order.Remove(e)
+		delete(c.items, k)
+	}
+}
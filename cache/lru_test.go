@@ -0,0 +1,65 @@
+package cache
+
+import "testing"
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	// Using a makes b the one to go.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a missing")
+	}
+	c.Add("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for k, want := range map[string]int{"a": 1, "c": 3} {
+		if v, ok := c.Get(k); !ok || v != want {
+			t.Errorf("Get(%q) = %d, %v; want %d, true", k, v, ok, want)
+		}
+	}
+}
+
+func TestLRUUpdate(t *testing.T) {
+	c := New[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("a", 10)
+
+	if v, _ := c.Get("a"); v != 10 {
+		t.Errorf("Get(a) = %d, want 10", v)
+	}
+
+	// Updating a counts as using it, and doesn't take up another slot.
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a should still be there")
+	}
+}
+
+func TestLRURemove(t *testing.T) {
+	c := New[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Remove("a")
+	c.Remove("missing")
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("a should be gone")
+	}
+
+	// The freed slot is usable without evicting b.
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); !ok {
+		t.Error("b should still be there")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Error("c should be there")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,6 +16,7 @@ type Config struct {
 		MainBranch []string `yaml:"mainBranch"`
 		Ignore     []string `yaml:"ignore,omitempty"`
 		Unlisted   []string `yaml:"unlisted,omitempty"`
+		Notes      []string `yaml:"notes,omitempty"`
 	} `yaml:"repo"`
 	Dirs struct {
 		Templates string `yaml:"templates"`
@@ -25,6 +27,39 @@ type Config struct {
 		Description     string `yaml:"description"`
 		SyntaxHighlight string `yaml:"syntaxHighlight"`
 	} `yaml:"meta"`
+	Diff struct {
+		MaxFiles     int `yaml:"maxFiles"`
+		MaxLines     int `yaml:"maxLines"`
+		MaxFileLines int `yaml:"maxFileLines"`
+	} `yaml:"diff"`
+	Blob struct {
+		MaxBytes          int64 `yaml:"maxBytes"`
+		MaxLines          int   `yaml:"maxLines"`
+		MaxHighlightBytes int64 `yaml:"maxHighlightBytes"`
+		MaxHighlightLines int   `yaml:"maxHighlightLines"`
+	} `yaml:"blob"`
+	Search struct {
+		MaxMatches   int           `yaml:"maxMatches"`
+		MaxFileBytes int64         `yaml:"maxFileBytes"`
+		Timeout      time.Duration `yaml:"timeout"`
+		Index        string        `yaml:"index,omitempty"`
+		Refresh      time.Duration `yaml:"refresh"`
+	} `yaml:"search"`
+	Raw struct {
+		Attachment []string `yaml:"attachment"`
+	} `yaml:"raw"`
+	Filters struct {
+		Timeout time.Duration `yaml:"timeout"`
+		Files   []struct {
+			Match   string   `yaml:"match"`
+			Command []string `yaml:"command"`
+		} `yaml:"files,omitempty"`
+		Commit []string `yaml:"commit,omitempty"`
+	} `yaml:"filters"`
+	Keys struct {
+		PGP            []string `yaml:"pgp,omitempty"`
+		AllowedSigners string   `yaml:"allowedSigners,omitempty"`
+	} `yaml:"keys"`
 	Server struct {
 		Name string `yaml:"name,omitempty"`
 		Host string `yaml:"host"`
@@ -53,5 +88,72 @@ func Read(f string) (*Config, error) {
 		return nil, err
 	}
 
+	for i, k := range c.Keys.PGP {
+		if c.Keys.PGP[i], err = filepath.Abs(k); err != nil {
+			return nil, err
+		}
+	}
+	if c.Search.Index != "" {
+		if c.Search.Index, err = filepath.Abs(c.Search.Index); err != nil {
+			return nil, err
+		}
+	}
+	if c.Keys.AllowedSigners != "" {
+		if c.Keys.AllowedSigners, err = filepath.Abs(c.Keys.AllowedSigners); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Blob.MaxBytes == 0 {
+		c.Blob.MaxBytes = 2 << 20
+	}
+	if c.Blob.MaxLines == 0 {
+		c.Blob.MaxLines = 20000
+	}
+	if c.Blob.MaxHighlightBytes == 0 {
+		c.Blob.MaxHighlightBytes = 512 << 10
+	}
+	if c.Blob.MaxHighlightLines == 0 {
+		c.Blob.MaxHighlightLines = 10000
+	}
+
+	if c.Search.MaxMatches == 0 {
+		c.Search.MaxMatches = 200
+	}
+	if c.Search.MaxFileBytes == 0 {
+		c.Search.MaxFileBytes = 1 << 20
+	}
+	if c.Search.Timeout == 0 {
+		c.Search.Timeout = 10 * time.Second
+	}
+	if c.Search.Refresh == 0 {
+		c.Search.Refresh = time.Minute
+	}
+
+	if c.Raw.Attachment == nil {
+		c.Raw.Attachment = []string{
+			"text/html",
+			"application/xhtml+xml",
+			"image/svg+xml",
+			"text/xml",
+			"application/xml",
+		}
+	}
+
+	if c.Filters.Timeout == 0 {
+		c.Filters.Timeout = 5 * time.Second
+	}
+
+	// Zero means the default; a cap below zero is turned off.
+	if c.Diff.MaxFiles == 0 {
+		c.Diff.MaxFiles = 300
+	}
+	if c.Diff.MaxLines == 0 {
+		c.Diff.MaxLines = 10000
+	}
+	if c.Diff.MaxFileLines == 0 {
+		c.Diff.MaxFileLines = 2000
+	}
+
 	return &c, nil
 }
@@ -0,0 +1,63 @@
+package git
+
+import (
+	"fmt"
+	"time"
+
+	"git.icyphox.sh/legit/cache"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Activity counts the commits in a history by when they were authored, in
+// the author's own time zone.
+type Activity struct {
+	// days maps dates, as "2006-01-02", to commits.
+	days map[string]int
+	// Hours counts commits by weekday, Sunday first, and hour of the day.
+	Hours [7][24]int
+	Total int
+}
+
+// activityCache holds activity by commit hash; the history behind a commit
+// never changes.
+var activityCache = cache.New[plumbing.Hash, *Activity](256)
+
+// Activity counts the commits in the history of the current commit.
+func (g *GitRepo) Activity() (*Activity, error) {
+	if a, ok := activityCache.Get(g.h); ok {
+		return a, nil
+	}
+
+	ci, err := g.r.Log(&git.LogOptions{From: g.h})
+	if err != nil {
+		return nil, fmt.Errorf("commits from ref: %w", err)
+	}
+
+	a := &Activity{days: map[string]int{}}
+	err = ci.ForEach(func(c *object.Commit) error {
+		when := c.Author.When
+		a.days[when.Format(time.DateOnly)]++
+		a.Hours[when.Weekday()][when.Hour()]++
+		a.Total++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking commits: %w", err)
+	}
+
+	activityCache.Add(g.h, a)
+	return a, nil
+}
+
+// CachedActivity is Activity, but only if it's already been counted; it
+// never walks the history.
+func (g *GitRepo) CachedActivity() (*Activity, bool) {
+	return activityCache.Get(g.h)
+}
+
+// Day returns the number of commits authored on the date of t.
+func (a *Activity) Day(t time.Time) int {
+	return a.days[t.Format(time.DateOnly)]
+}
@@ -0,0 +1,218 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// attrLine is one pattern line of a .gitattributes file.
+type attrLine struct {
+	pattern string
+	attrs   []attrState
+}
+
+// attrState is a single attribute on a line: set to a value, "true" for
+// `attr` and "false" for `-attr`, or unspecified again for `!attr`.
+type attrState struct {
+	name        string
+	value       string
+	unspecified bool
+}
+
+// The one macro git defines itself.
+var builtinMacros = map[string][]attrState{
+	"binary": {{name: "diff", value: "false"}, {name: "merge", value: "false"}, {name: "text", value: "false"}},
+}
+
+// attrReader looks up gitattributes in a tree, reading each directory's
+// .gitattributes once. Like git, files deeper in the tree take precedence,
+// as do later lines within a file.
+type attrReader struct {
+	tree   *object.Tree
+	files  map[string][]attrLine
+	macros map[string][]attrState
+}
+
+func newAttrReader(t *object.Tree) *attrReader {
+	a := &attrReader{
+		tree:   t,
+		files:  map[string][]attrLine{},
+		macros: map[string][]attrState{},
+	}
+	// Macros can only be defined at the top level, so read that first.
+	a.lines(".")
+	return a
+}
+
+// Attributes returns the gitattributes that apply to path, as set in the
+// .gitattributes files of the current commit.
+func (g *GitRepo) Attributes(path string) (map[string]string, error) {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return nil, fmt.Errorf("commit object: %w", err)
+	}
+
+	t, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("file tree: %w", err)
+	}
+	return newAttrReader(t).get(path), nil
+}
+
+// get returns the attributes of the file at p.
+func (a *attrReader) get(p string) map[string]string {
+	attrs := map[string]string{}
+
+	dirs := []string{"."}
+	if d := path.Dir(p); d != "." {
+		parts := strings.Split(d, "/")
+		for i := range parts {
+			dirs = append(dirs, strings.Join(parts[:i+1], "/"))
+		}
+	}
+
+	for _, dir := range dirs {
+		rel := p
+		if dir != "." {
+			rel = strings.TrimPrefix(p, dir+"/")
+		}
+		for _, l := range a.lines(dir) {
+			if matchGlob(l.pattern, rel) {
+				a.apply(attrs, l.attrs)
+			}
+		}
+	}
+	return attrs
+}
+
+func (a *attrReader) apply(attrs map[string]string, states []attrState) {
+	for _, s := range states {
+		switch {
+		case s.unspecified:
+			delete(attrs, s.name)
+		case s.value == "true":
+			attrs[s.name] = s.value
+			if m, ok := a.macro(s.name); ok {
+				a.apply(attrs, m)
+			}
+		default:
+			attrs[s.name] = s.value
+		}
+	}
+}
+
+func (a *attrReader) macro(name string) ([]attrState, bool) {
+	if m, ok := a.macros[name]; ok {
+		return m, true
+	}
+	m, ok := builtinMacros[name]
+	return m, ok
+}
+
+// lines returns the pattern lines of dir's .gitattributes, if it has one.
+func (a *attrReader) lines(dir string) []attrLine {
+	if lines, ok := a.files[dir]; ok {
+		return lines
+	}
+
+	var lines []attrLine
+	if f, err := a.tree.File(path.Join(dir, ".gitattributes")); err == nil {
+		if content, err := f.Contents(); err == nil {
+			lines = a.parse(content, dir == ".")
+		}
+	}
+	a.files[dir] = lines
+	return lines
+}
+
+// parse reads a .gitattributes file. Macro definitions are only honoured
+// at the top level, as in git.
+func (a *attrReader) parse(content string, top bool) []attrLine {
+	var lines []attrLine
+
+	s := bufio.NewScanner(strings.NewReader(content))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		states := parseAttrStates(fields[1:])
+		if name, ok := strings.CutPrefix(fields[0], "[attr]"); ok {
+			if top {
+				a.macros[name] = states
+			}
+			continue
+		}
+		lines = append(lines, attrLine{pattern: fields[0], attrs: states})
+	}
+	return lines
+}
+
+func parseAttrStates(fields []string) []attrState {
+	var states []attrState
+	for _, f := range fields {
+		switch {
+		case strings.HasPrefix(f, "-"):
+			states = append(states, attrState{name: f[1:], value: "false"})
+		case strings.HasPrefix(f, "!"):
+			states = append(states, attrState{name: f[1:], unspecified: true})
+		default:
+			name, value, ok := strings.Cut(f, "=")
+			if !ok {
+				value = "true"
+			}
+			states = append(states, attrState{name: name, value: value})
+		}
+	}
+	return states
+}
+
+// matchGlob reports whether p matches pattern, the way gitattributes
+// patterns match paths relative to their directory. Patterns without a
+// slash match the base name at any depth; others are anchored and may use
+// `**`.
+func matchGlob(pattern, p string) bool {
+	if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where
+// `**` matches any number of segments. It fills in a table rather than
+// backtracking, so it takes time proportional to the two lengths
+// multiplied, however many `**` there are.
+func matchSegments(pattern, p []string) bool {
+	// A run of `**` matches the same as one.
+	pattern = slices.CompactFunc(pattern, func(a, b string) bool {
+		return a == "**" && b == "**"
+	})
+
+	// match[i][j] is whether pattern[i:] matches p[j:].
+	match := make([][]bool, len(pattern)+1)
+	for i := range match {
+		match[i] = make([]bool, len(p)+1)
+	}
+	match[len(pattern)][len(p)] = true
+
+	for i := len(pattern) - 1; i >= 0; i-- {
+		for j := len(p); j >= 0; j-- {
+			switch {
+			case pattern[i] == "**":
+				match[i][j] = match[i+1][j] || (j < len(p) && match[i][j+1])
+			case j < len(p):
+				ok, _ := path.Match(pattern[i], p[j])
+				match[i][j] = ok && match[i+1][j+1]
+			}
+		}
+	}
+	return match[0][0]
+}
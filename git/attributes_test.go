@@ -0,0 +1,47 @@
+package git
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "git/git.go", true},
+		{"*.go", "main.c", false},
+		{"docs/*.md", "docs/readme.md", true},
+		{"docs/*.md", "docs/sub/readme.md", false},
+		{"/docs/*.md", "docs/readme.md", true},
+		{"docs/**", "docs/a/b/c.md", true},
+		{"**/*.md", "readme.md", true},
+		{"**/*.md", "a/b/readme.md", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"a/**/**/b", "a/x/b", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchGlobManyStars(t *testing.T) {
+	pattern := strings.Repeat("**/a/", 18) + "x"
+	p := strings.Repeat("a/", 11) + "b"
+
+	start := time.Now()
+	if matchGlob(pattern, p) {
+		t.Errorf("matchGlob(%q, %q) = true", pattern, p)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("matchGlob took %s", d)
+	}
+}
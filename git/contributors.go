@@ -0,0 +1,89 @@
+package git
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"git.icyphox.sh/legit/cache"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Contributor is someone who authored commits in a history.
+type Contributor struct {
+	Name    string
+	Email   string
+	Commits int
+	// First and Last are the author dates of their earliest and latest
+	// commits.
+	First time.Time
+	Last  time.Time
+}
+
+// contributorsCache holds contributor lists by commit and .mailmap; the
+// history behind a commit never changes.
+var contributorsCache = cache.New[string, []Contributor](128)
+
+// Contributors lists the authors of the history of the current commit,
+// most commits first. Authors are mapped through the repo's .mailmap and
+// told apart by email; each goes by the name on their latest commit.
+func (g *GitRepo) Contributors() ([]Contributor, error) {
+	mm, err := g.Mailmap()
+	if err != nil {
+		log.Println(err)
+	}
+
+	key := g.h.String() + ":" + mm.key()
+	if cs, ok := contributorsCache.Get(key); ok {
+		return cs, nil
+	}
+
+	ci, err := g.r.Log(&git.LogOptions{From: g.h})
+	if err != nil {
+		return nil, fmt.Errorf("commits from ref: %w", err)
+	}
+
+	byEmail := map[string]*Contributor{}
+	err = ci.ForEach(func(c *object.Commit) error {
+		a := mm.Map(c.Author)
+		k := strings.ToLower(a.Email)
+
+		cs, ok := byEmail[k]
+		if !ok {
+			cs = &Contributor{First: a.When, Last: a.When}
+			byEmail[k] = cs
+		}
+		cs.Commits++
+		if a.When.Before(cs.First) {
+			cs.First = a.When
+		}
+		if !a.When.Before(cs.Last) || cs.Name == "" {
+			cs.Name, cs.Email, cs.Last = a.Name, a.Email, a.When
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking commits: %w", err)
+	}
+
+	contributors := make([]Contributor, 0, len(byEmail))
+	for _, cs := range byEmail {
+		contributors = append(contributors, *cs)
+	}
+	sort.Slice(contributors, func(i, j int) bool {
+		a, b := contributors[i], contributors[j]
+		if a.Commits != b.Commits {
+			return a.Commits > b.Commits
+		}
+		if !a.Last.Equal(b.Last) {
+			return a.Last.After(b.Last)
+		}
+		return a.Name < b.Name
+	})
+
+	contributorsCache.Add(key, contributors)
+	return contributors, nil
+}
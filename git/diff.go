@@ -1,17 +1,54 @@
 package git
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"log"
+	"slices"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/bluekeyes/go-gitdiff/gitdiff"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
+// ExpandLines is how many lines expanding around a hunk reveals.
+const ExpandLines = 20
+
+// maxContextBytes is the largest file context is expanded from.
+const maxContextBytes = 1 << 20
+
+// LineRange is an inclusive range of 1-indexed lines in a file. A zero
+// range means there's nothing to show.
+type LineRange struct {
+	From int64
+	To   int64
+}
+
+// Line is an unchanged line of a file, with its numbers in the old and
+// new versions, counting from 1.
+type Line struct {
+	Old, New int64
+	Text     string
+}
+
 type TextFragment struct {
 	Header string
 	Lines  []gitdiff.Line
+	// Unchanged lines around this fragment that aren't part of any hunk,
+	// for expanding it in place. They're only filled in for diffs of a
+	// single file; otherwise Expandable says whether there are any.
+	Above      []Line
+	Below      []Line
+	Expandable bool
+	// above and below are where Above and Below come from, in the new
+	// file, and offset is what to add to get to the old one.
+	above, below LineRange
+	offset       int64
 }
 
 type Diff struct {
@@ -19,10 +56,32 @@ type Diff struct {
 		Old string
 		New string
 	}
+	Stat struct {
+		Insertions int
+		Deletions  int
+	}
 	TextFragments []TextFragment
 	IsBinary      bool
 	IsNew         bool
 	IsDelete      bool
+	// Collapsed diffs have their fragments left out, with the reason
+	// why; they can be loaded on their own with DiffOptions.Path.
+	Collapsed      bool
+	CollapseReason string
+	// Uncounted diffs were collapsed without being diffed, so Stat is
+	// left at zero.
+	Uncounted bool
+	// Encoding is what the file was decoded from, if it wasn't UTF-8.
+	Encoding string
+}
+
+// Path returns the file's name after the change, or before it for
+// deletions.
+func (d Diff) Path() string {
+	if d.Name.New != "" {
+		return d.Name.New
+	}
+	return d.Name.Old
 }
 
 // A nicer git diff representation.
@@ -37,83 +96,690 @@ type NiceDiff struct {
 		FilesChanged int
 		Insertions   int
 		Deletions    int
+		// Uncounted is how many files aren't in Insertions and
+		// Deletions, see Diff.Uncounted.
+		Uncounted int
 	}
 	Diff []Diff
 }
 
-func (g *GitRepo) Diff() (*NiceDiff, error) {
+// DiffOptions controls how a commit's changes are computed.
+type DiffOptions struct {
+	// Context is the number of unchanged lines shown around each change;
+	// anything below zero means git's default of 3.
+	Context int
+	// IgnoreWhitespace compares lines with all whitespace removed, like
+	// `git diff -w`.
+	IgnoreWhitespace bool
+	// Path limits the diff to a single file, which is never collapsed.
+	Path string
+	// Caps on what's rendered in full; files past them are collapsed.
+	// Zero or less means no limit.
+	MaxFiles     int
+	MaxLines     int
+	MaxFileLines int
+}
+
+func (g *GitRepo) Diff(opts DiffOptions) (*NiceDiff, error) {
 	c, err := g.r.CommitObject(g.h)
 	if err != nil {
 		return nil, fmt.Errorf("commit object: %w", err)
 	}
 
-	patch := &object.Patch{}
-	commitTree, err := c.Tree()
-	parent := &object.Commit{}
-	if err == nil {
-		parentTree := &object.Tree{}
-		if c.NumParents() != 0 {
-			parent, err = c.Parents().Next()
-			if err == nil {
-				parentTree, err = parent.Tree()
-				if err == nil {
-					patch, err = parentTree.Patch(commitTree)
-					if err != nil {
-						return nil, fmt.Errorf("patch: %w", err)
-					}
-				}
-			}
-		} else {
-			patch, err = parentTree.Patch(commitTree)
-			if err != nil {
-				return nil, fmt.Errorf("patch: %w", err)
-			}
+	if opts.Context < 0 {
+		opts.Context = fdiff.DefaultContextLines
+	}
+
+	newTree, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("commit tree: %w", err)
+	}
+	var parent *object.Commit
+	oldTree := &object.Tree{}
+	if c.NumParents() != 0 {
+		if parent, err = c.Parents().Next(); err != nil {
+			return nil, fmt.Errorf("parent commit: %w", err)
+		}
+		if oldTree, err = parent.Tree(); err != nil {
+			return nil, fmt.Errorf("parent tree: %w", err)
+		}
+	}
+
+	changes, err := treeChanges(oldTree, newTree, opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collapsing is decided from the changes before anything is diffed,
+	// so that a large commit doesn't cost more than the part shown.
+	reasons := collapseReasons(changes, opts)
+	var keep object.Changes
+	for i, ch := range changes {
+		if reasons[i] == "" {
+			keep = append(keep, ch)
 		}
 	}
 
-	diffs, _, err := gitdiff.Parse(strings.NewReader(patch.String()))
+	patch, err := keep.Patch()
+	if err != nil {
+		return nil, fmt.Errorf("patch: %w", err)
+	}
+
+	p, encodings := g.decodePatch(patch, newAttrReader(oldTree), newAttrReader(newTree))
+	if opts.IgnoreWhitespace {
+		p = ignoreWhitespace(p)
+	}
+
+	var buf bytes.Buffer
+	if err := fdiff.NewUnifiedEncoder(&buf, opts.Context).Encode(p); err != nil {
+		return nil, fmt.Errorf("encoding patch: %w", err)
+	}
+
+	files, _, err := gitdiff.Parse(&buf)
 	if err != nil {
 		log.Println(err)
 	}
+	parsed := make(map[string]*gitdiff.File, len(files))
+	for _, f := range files {
+		if f.IsDelete {
+			parsed[f.OldName] = f
+		} else {
+			parsed[f.NewName] = f
+		}
+	}
 
 	nd := NiceDiff{}
 	nd.Commit.This = c.Hash.String()
 
-	if parent.Hash.IsZero() {
-		nd.Commit.Parent = ""
-	} else {
+	if parent != nil {
 		nd.Commit.Parent = parent.Hash.String()
 	}
-	nd.Commit.Author = c.Author
+	mm, err := g.Mailmap()
+	if err != nil {
+		// A broken .mailmap shouldn't break the page; names are
+		// just left as they are.
+		log.Println(err)
+	}
+	nd.Commit.Author = mm.Map(c.Author)
 	nd.Commit.Message = c.Message
 
-	for _, d := range diffs {
+	// Changed lines rendered so far, counted against opts.MaxLines.
+	var rendered int
+	for i, ch := range changes {
 		ndiff := Diff{}
-		ndiff.Name.New = d.NewName
-		ndiff.Name.Old = d.OldName
+		ndiff.Name.New = ch.To.Name
+		ndiff.Name.Old = ch.From.Name
+		ndiff.IsNew = ch.From.Name == ""
+		ndiff.IsDelete = ch.To.Name == ""
+
+		if reasons[i] != "" {
+			ndiff.Collapsed = true
+			ndiff.CollapseReason = reasons[i]
+			ndiff.Uncounted = true
+			nd.Stat.Uncounted++
+			nd.Diff = append(nd.Diff, ndiff)
+			continue
+		}
+
+		d, ok := parsed[ndiff.Path()]
+		if !ok {
+			// Nothing left to show, like a change that was only
+			// whitespace.
+			continue
+		}
 		ndiff.IsBinary = d.IsBinary
-		ndiff.IsNew = d.IsNew
-		ndiff.IsDelete = d.IsDelete
+		ndiff.Encoding = encodings[ndiff.Path()]
 
+		// Line numbers of the new file already covered by a hunk.
+		var shown int64
 		for _, tf := range d.TextFragments {
-			ndiff.TextFragments = append(ndiff.TextFragments, TextFragment{
+			frag := TextFragment{
 				Header: tf.Header(),
 				Lines:  tf.Lines,
-			})
+				offset: tf.OldPosition - tf.NewPosition,
+			}
+
+			// New and deleted files are shown in full, so there's
+			// nothing to expand.
+			if !d.IsNew && !d.IsDelete {
+				if tf.NewPosition > shown+1 {
+					frag.above = LineRange{
+						From: max(shown+1, tf.NewPosition-ExpandLines),
+						To:   tf.NewPosition - 1,
+					}
+					frag.Expandable = true
+				}
+				shown = tf.NewPosition + tf.NewLines - 1
+			}
+
+			ndiff.TextFragments = append(ndiff.TextFragments, frag)
 			for _, l := range tf.Lines {
 				switch l.Op {
 				case gitdiff.OpAdd:
-					nd.Stat.Insertions += 1
+					ndiff.Stat.Insertions += 1
 				case gitdiff.OpDelete:
-					nd.Stat.Deletions += 1
+					ndiff.Stat.Deletions += 1
 				}
 			}
 		}
 
+		nd.Stat.Insertions += ndiff.Stat.Insertions
+		nd.Stat.Deletions += ndiff.Stat.Deletions
+
+		// We don't know where the file ends yet; expandContext stops
+		// at EOF.
+		if n := len(ndiff.TextFragments); n > 0 && shown > 0 {
+			last := &ndiff.TextFragments[n-1]
+			last.below = LineRange{
+				From: shown + 1,
+				To:   shown + ExpandLines,
+			}
+			last.Expandable = true
+		}
+
+		// The estimates in collapseReasons are only lower bounds, so
+		// the caps are checked again now the real numbers are known.
+		if opts.Path == "" {
+			changed := ndiff.Stat.Insertions + ndiff.Stat.Deletions
+			switch {
+			case opts.MaxFileLines > 0 && changed > opts.MaxFileLines:
+				ndiff.CollapseReason = "large diff"
+			case opts.MaxLines > 0 && rendered+changed > opts.MaxLines:
+				ndiff.CollapseReason = "diff limit reached"
+			default:
+				rendered += changed
+			}
+
+			if ndiff.CollapseReason != "" {
+				ndiff.Collapsed = true
+				ndiff.TextFragments = nil
+			}
+		}
+
+		// Context means reading the whole file, so it's only worth it
+		// when that's the file being looked at.
+		if opts.Path != "" {
+			expandContext(&ndiff, newTree)
+		}
 		nd.Diff = append(nd.Diff, ndiff)
 	}
 
-	nd.Stat.FilesChanged = len(diffs)
+	nd.Stat.FilesChanged = len(nd.Diff)
 
 	return &nd, nil
 }
+
+// treeChanges lists the files that differ between two trees. If path is
+// set, only that file is kept, so loading one file of a large commit
+// doesn't mean diffing the rest.
+func treeChanges(oldTree, newTree *object.Tree, path string) (object.Changes, error) {
+	changes, err := object.DiffTree(oldTree, newTree)
+	if err != nil {
+		return nil, fmt.Errorf("diff tree: %w", err)
+	}
+
+	if path != "" {
+		changes = slices.DeleteFunc(changes, func(ch *object.Change) bool {
+			return ch.From.Name != path && ch.To.Name != path
+		})
+	}
+	return changes, nil
+}
+
+// collapseReasons decides which of changes to collapse without diffing
+// them, returning the reason for each, or "" for the ones to show. A
+// diff of a single path is never collapsed.
+// Changed lines are estimated from the difference in line counts, which
+// never overshoots, so nothing that fits the caps is collapsed here.
+func collapseReasons(changes object.Changes, opts DiffOptions) []string {
+	reasons := make([]string, len(changes))
+	if opts.Path != "" {
+		return reasons
+	}
+	countLines := opts.MaxFileLines > 0 || opts.MaxLines > 0
+
+	// Lower bound on the changed lines of the files kept so far.
+	var estimated int
+	for i, ch := range changes {
+		name := ch.To.Name
+		if name == "" {
+			name = ch.From.Name
+		}
+
+		if opts.MaxFiles > 0 && i >= opts.MaxFiles {
+			reasons[i] = "too many files changed"
+			continue
+		}
+		if isVendored(name) {
+			reasons[i] = "vendored"
+			continue
+		}
+		if isGeneratedName(name) {
+			reasons[i] = "generated"
+			continue
+		}
+
+		from, to, err := ch.Files()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		oldSum, err := summarizeFile(from)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		newSum, err := summarizeFile(to)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if isGenerated(name, newSum.head) {
+			reasons[i] = "generated"
+			continue
+		}
+		if !countLines || oldSum.binary || newSum.binary {
+			continue
+		}
+
+		changed := newSum.lines - oldSum.lines
+		if changed < 0 {
+			changed = -changed
+		}
+		switch {
+		case opts.MaxFileLines > 0 && changed > opts.MaxFileLines:
+			reasons[i] = "large diff"
+		case opts.MaxLines > 0 && estimated+changed > opts.MaxLines:
+			reasons[i] = "diff limit reached"
+		default:
+			estimated += changed
+		}
+	}
+	return reasons
+}
+
+// headLines is how far into a file isGenerated looks for a marker.
+const headLines = 10
+
+// fileSummary is what collapseReasons reads from a file: its line
+// count, its first few lines, and whether it's binary, judged the way
+// git does by a NUL in the first 8000 bytes.
+type fileSummary struct {
+	lines  int
+	head   []string
+	binary bool
+}
+
+// summarizeFile reads f in a single pass; a nil f is an empty summary.
+func summarizeFile(f *object.File) (fileSummary, error) {
+	var s fileSummary
+	if f == nil {
+		return s, nil
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return s, fmt.Errorf("reading %s: %w", f.Name, err)
+	}
+	defer r.Close()
+
+	br := bufio.NewReader(r)
+	var read int
+	// Whether the last chunk read ended partway through a line.
+	var partial bool
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if read < 8000 && bytes.IndexByte(chunk[:min(len(chunk), 8000-read)], 0) >= 0 {
+			s.binary = true
+			return s, nil
+		}
+		read += len(chunk)
+
+		if len(chunk) > 0 {
+			if !partial && len(s.head) < headLines {
+				s.head = append(s.head, string(chunk))
+			}
+			partial = chunk[len(chunk)-1] != '\n'
+			if !partial {
+				s.lines++
+			}
+		}
+
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			if partial {
+				s.lines++
+			}
+			return s, nil
+		default:
+			return s, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+	}
+}
+
+// expandContext fills in the unchanged lines around each of d's
+// fragments, reading them from the new file in t; outside hunks, the old
+// one is the same. Files over maxContextBytes are left alone.
+func expandContext(d *Diff, t *object.Tree) {
+	if len(d.TextFragments) == 0 || d.IsNew || d.IsDelete {
+		return
+	}
+
+	f, err := t.File(d.Name.New)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if f.Size > maxContextBytes {
+		return
+	}
+	content, err := f.Contents()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	lines := splitLines(content)
+	for i := range d.TextFragments {
+		frag := &d.TextFragments[i]
+		frag.Above = numberLines(lines, frag.above, frag.offset)
+		// Below only comes after the last fragment, which the old file
+		// is offset from by however many lines it added or removed.
+		below := frag.offset
+		for _, l := range frag.Lines {
+			switch l.Op {
+			case gitdiff.OpAdd:
+				below--
+			case gitdiff.OpDelete:
+				below++
+			}
+		}
+		frag.Below = numberLines(lines, frag.below, below)
+	}
+}
+
+// numberLines returns lines in r, which is clamped to the lines there
+// are, numbered in the new file and, offset by offset, the old one.
+func numberLines(lines []string, r LineRange, offset int64) []Line {
+	from, to := max(r.From, 1), min(r.To, int64(len(lines)))
+	if from > to {
+		return nil
+	}
+
+	out := make([]Line, 0, to-from+1)
+	for i, l := range lines[from-1 : to] {
+		n := from + int64(i)
+		out = append(out, Line{Old: n + offset, New: n, Text: strings.TrimSuffix(l, "\n")})
+	}
+	return out
+}
+
+// textPatch is a patch with some of its text file patches recomputed,
+// after decoding them or ignoring whitespace.
+type textPatch struct {
+	message     string
+	filePatches []fdiff.FilePatch
+}
+
+func (p *textPatch) FilePatches() []fdiff.FilePatch {
+	return p.filePatches
+}
+
+func (p *textPatch) Message() string {
+	return p.message
+}
+
+type textFilePatch struct {
+	from, to fdiff.File
+	chunks   []fdiff.Chunk
+}
+
+func (fp *textFilePatch) IsBinary() bool {
+	return false
+}
+
+func (fp *textFilePatch) Files() (fdiff.File, fdiff.File) {
+	return fp.from, fp.to
+}
+
+func (fp *textFilePatch) Chunks() []fdiff.Chunk {
+	return fp.chunks
+}
+
+type textChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c *textChunk) Content() string {
+	return c.content
+}
+
+func (c *textChunk) Type() fdiff.Operation {
+	return c.op
+}
+
+// ignoreWhitespace rediffs every text file in p comparing lines with all
+// whitespace stripped. Context lines are taken from the new file, and
+// files left with no changes besides whitespace are dropped.
+func ignoreWhitespace(p fdiff.Patch) fdiff.Patch {
+	out := &textPatch{message: p.Message()}
+
+	for _, fp := range p.FilePatches() {
+		from, to := fp.Files()
+		if fp.IsBinary() || from == nil || to == nil {
+			out.filePatches = append(out.filePatches, fp)
+			continue
+		}
+
+		var oldText, newText strings.Builder
+		for _, c := range fp.Chunks() {
+			switch c.Type() {
+			case fdiff.Equal:
+				oldText.WriteString(c.Content())
+				newText.WriteString(c.Content())
+			case fdiff.Delete:
+				oldText.WriteString(c.Content())
+			case fdiff.Add:
+				newText.WriteString(c.Content())
+			}
+		}
+
+		chunks := diffLines(oldText.String(), newText.String(), stripLines)
+		changed := from.Path() != to.Path() || from.Mode() != to.Mode()
+		for _, c := range chunks {
+			if c.Type() != fdiff.Equal {
+				changed = true
+			}
+		}
+		if changed {
+			out.filePatches = append(out.filePatches, &textFilePatch{
+				from:   from,
+				to:     to,
+				chunks: chunks,
+			})
+		}
+	}
+
+	return out
+}
+
+// decodePatch rediffs the text files in p that aren't UTF-8, once both
+// sides are decoded. That includes UTF-16 files, which look binary to git.
+// It returns the encodings of the files it decoded, by path.
+func (g *GitRepo) decodePatch(p fdiff.Patch, oldAttrs, newAttrs *attrReader) (fdiff.Patch, map[string]string) {
+	out := &textPatch{message: p.Message()}
+	encodings := map[string]string{}
+
+	for _, fp := range p.FilePatches() {
+		from, to := fp.Files()
+
+		var oldAttr, newAttr string
+		if from != nil {
+			oldAttr = oldAttrs.get(from.Path())["working-tree-encoding"]
+		}
+		if to != nil {
+			newAttr = newAttrs.get(to.Path())["working-tree-encoding"]
+		}
+		if oldAttr == "" && newAttr == "" && !g.mayNeedDecoding(fp) {
+			out.filePatches = append(out.filePatches, fp)
+			continue
+		}
+
+		oldText, oldEnc, oldOK := g.blobText(from, oldAttr)
+		newText, newEnc, newOK := g.blobText(to, newAttr)
+		if !oldOK || !newOK || (oldEnc.enc == nil && newEnc.enc == nil) {
+			out.filePatches = append(out.filePatches, fp)
+			continue
+		}
+
+		out.filePatches = append(out.filePatches, &textFilePatch{
+			from: from,
+			to:   to,
+			chunks: diffLines(oldText, newText, func(lines []string) string {
+				return strings.Join(lines, "")
+			}),
+		})
+
+		name := newEnc.name
+		if name == "" {
+			name = oldEnc.name
+		}
+		if name == "" {
+			continue
+		}
+		if to != nil {
+			encodings[to.Path()] = name
+		} else {
+			encodings[from.Path()] = name
+		}
+	}
+
+	return out, encodings
+}
+
+// mayNeedDecoding is a cheap check for whether either side of fp might
+// not be UTF-8: binary files that turn out to be UTF-16, and text with
+// invalid UTF-8 in the changes.
+func (g *GitRepo) mayNeedDecoding(fp fdiff.FilePatch) bool {
+	if !fp.IsBinary() {
+		for _, c := range fp.Chunks() {
+			if !utf8.ValidString(c.Content()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	from, to := fp.Files()
+	for _, f := range []fdiff.File{from, to} {
+		if f == nil {
+			continue
+		}
+		b, err := g.readBlob(f, sniffLen)
+		if err != nil {
+			continue
+		}
+		if te, ok := detectEncoding(b, ""); ok && te.enc != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// blobText decodes the blob of f, which is empty if f is nil. It returns
+// false if the blob is binary after all.
+func (g *GitRepo) blobText(f fdiff.File, attr string) (string, textEncoding, bool) {
+	if f == nil {
+		return "", textEncoding{}, true
+	}
+	b, err := g.readBlob(f, -1)
+	if err != nil {
+		log.Println(err)
+		return "", textEncoding{}, false
+	}
+	te, ok := detectEncoding(b, attr)
+	return te.decode(b), te, ok
+}
+
+// readBlob reads up to n bytes of f's blob, or all of it if n is
+// negative.
+func (g *GitRepo) readBlob(f fdiff.File, n int64) ([]byte, error) {
+	blob, err := g.r.BlobObject(f.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", f.Hash(), err)
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if n < 0 {
+		return io.ReadAll(r)
+	}
+	return io.ReadAll(io.LimitReader(r, n))
+}
+
+// diffLines diffs two texts line by line, comparing the lines as key
+// rewrites them.
+func diffLines(oldText, newText string, key func([]string) string) []fdiff.Chunk {
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+
+	dmp := diffmatchpatch.New()
+	a, b, _ := dmp.DiffLinesToRunes(key(oldLines), key(newLines))
+	diffs := dmp.DiffMainRunes(a, b, false)
+
+	var chunks []fdiff.Chunk
+	add := func(op fdiff.Operation, lines []string) {
+		content := strings.Join(lines, "")
+		if n := len(chunks); n > 0 && chunks[n-1].Type() == op {
+			chunks[n-1].(*textChunk).content += content
+			return
+		}
+		chunks = append(chunks, &textChunk{content: content, op: op})
+	}
+
+	// Each rune stands for one line, so the rune counts tell us how far
+	// to advance through the original lines.
+	var i, j int
+	for _, d := range diffs {
+		n := utf8.RuneCountInString(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			add(fdiff.Equal, newLines[j:j+n])
+			i += n
+			j += n
+		case diffmatchpatch.DiffDelete:
+			add(fdiff.Delete, oldLines[i:i+n])
+			i += n
+		case diffmatchpatch.DiffInsert:
+			add(fdiff.Add, newLines[j:j+n])
+			j += n
+		}
+	}
+
+	return chunks
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	return lines
+}
+
+// stripLines removes all whitespace from each line, keeping one line per
+// line so the result can be diffed line-wise.
+func stripLines(lines []string) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		sb.WriteString(strings.Join(strings.Fields(l), ""))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
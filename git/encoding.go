@@ -0,0 +1,153 @@
+package git
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/japanese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// sniffLen is how much of a file is looked at to guess its encoding, and
+// to decide whether it's binary, as git does.
+const sniffLen = 8000
+
+// textEncoding is a character encoding a file was found to be in.
+type textEncoding struct {
+	enc encoding.Encoding
+	// name is shown to the user; it's empty for UTF-8.
+	name string
+}
+
+var (
+	utf8BOM     = textEncoding{enc: xunicode.UTF8BOM}
+	utf16LE     = textEncoding{xunicode.UTF16(xunicode.LittleEndian, xunicode.UseBOM), "UTF-16LE"}
+	utf16BE     = textEncoding{xunicode.UTF16(xunicode.BigEndian, xunicode.UseBOM), "UTF-16BE"}
+	shiftJIS    = textEncoding{japanese.ShiftJIS, "Shift_JIS"}
+	eucJP       = textEncoding{japanese.EUCJP, "EUC-JP"}
+	windows1252 = textEncoding{charmap.Windows1252, "windows-1252"}
+)
+
+// detectEncoding works out what b is encoded in: by its byte order mark,
+// then by whether it's UTF-8, then the working-tree-encoding attribute
+// attr, then by looking at it. It returns false if b looks binary. A nil
+// enc means UTF-8.
+func detectEncoding(b []byte, attr string) (textEncoding, bool) {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return utf8BOM, true
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return utf16LE, true
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return utf16BE, true
+	}
+
+	sniff := b[:min(len(b), sniffLen)]
+	binary := bytes.IndexByte(sniff, 0) >= 0
+
+	// Don't judge by a character cut in half at the end.
+	if len(b) > len(sniff) {
+		if i := bytes.LastIndexByte(sniff, '\n'); i >= 0 {
+			sniff = sniff[:i+1]
+		}
+	}
+	valid := !binary && utf8.Valid(trimPartialRune(sniff))
+
+	// git stores files with a working-tree-encoding as UTF-8, so the
+	// attribute only matters for files that aren't: ones committed before
+	// it was set, or by tools that don't support it.
+	if !valid && attr != "" && attr != "false" && attr != "true" {
+		if enc, err := ianaindex.IANA.Encoding(attr); err == nil && enc != nil {
+			return textEncoding{enc, attr}, true
+		}
+	}
+
+	switch {
+	case binary:
+		return sniffUTF16(b[:min(len(b), sniffLen)])
+	case valid:
+		return textEncoding{}, true
+	}
+	for _, te := range []textEncoding{shiftJIS, eucJP} {
+		if looksJapanese(te, sniff) {
+			return te, true
+		}
+	}
+	// Most of what's left is some flavour of Latin-1.
+	return windows1252, true
+}
+
+// sniffUTF16 spots UTF-16 without a byte order mark, going by mostly
+// ASCII text having every other byte zero.
+func sniffUTF16(b []byte) (textEncoding, bool) {
+	var even, odd int
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 {
+			even++
+		}
+		if b[i+1] == 0 {
+			odd++
+		}
+	}
+
+	pairs := len(b) / 2
+	switch {
+	case pairs == 0:
+		return textEncoding{}, false
+	case odd > pairs/2 && even == 0:
+		return utf16LE, true
+	case even > pairs/2 && odd == 0:
+		return utf16BE, true
+	}
+	return textEncoding{}, false
+}
+
+// looksJapanese reports whether b decodes cleanly in te to text with kana
+// in it. Bytes from Latin-1 text rarely pair up into valid characters, and
+// would hardly ever come out as kana.
+func looksJapanese(te textEncoding, b []byte) bool {
+	s, err := te.enc.NewDecoder().Bytes(b)
+	if err != nil || bytes.ContainsRune(s, utf8.RuneError) {
+		return false
+	}
+	for _, r := range string(s) {
+		if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimPartialRune drops what might be the start of a multibyte character
+// cut off at the end of b.
+func trimPartialRune(b []byte) []byte {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-3; i-- {
+		if b[i] < 0x80 {
+			break
+		}
+		if b[i] >= 0xc0 {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// decode converts b to UTF-8, returning it unchanged if it's UTF-8
+// already.
+func (te textEncoding) decode(b []byte) string {
+	if te.enc == nil {
+		return string(b)
+	}
+	s, err := te.enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(s)
+}
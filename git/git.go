@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"path"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
@@ -27,9 +28,11 @@ type TagList struct {
 // TagReference is used to list both tag and non-annotated tags.
 // Non-annotated tags should only contains a reference.
 // Annotated tags should contain its reference and its tag information.
+// commit is the tagged commit, if the tag points at one.
 type TagReference struct {
-	ref *plumbing.Reference
-	tag *object.Tag
+	ref    *plumbing.Reference
+	tag    *object.Tag
+	commit *object.Commit
 }
 
 // infoWrapper wraps the property of a TreeEntry so it can export fs.FileInfo
@@ -52,32 +55,7 @@ func (self *TagList) Swap(i, j int) {
 
 // sorting tags in reverse chronological order
 func (self *TagList) Less(i, j int) bool {
-	var dateI time.Time
-	var dateJ time.Time
-
-	if self.refs[i].tag != nil {
-		dateI = self.refs[i].tag.Tagger.When
-	} else {
-		c, err := self.r.CommitObject(self.refs[i].ref.Hash())
-		if err != nil {
-			dateI = time.Now()
-		} else {
-			dateI = c.Committer.When
-		}
-	}
-
-	if self.refs[j].tag != nil {
-		dateJ = self.refs[j].tag.Tagger.When
-	} else {
-		c, err := self.r.CommitObject(self.refs[j].ref.Hash())
-		if err != nil {
-			dateJ = time.Now()
-		} else {
-			dateJ = c.Committer.When
-		}
-	}
-
-	return dateI.After(dateJ)
+	return self.refs[i].Date().After(self.refs[j].Date())
 }
 
 func Open(path string, ref string) (*GitRepo, error) {
@@ -105,9 +83,14 @@ func Open(path string, ref string) (*GitRepo, error) {
 }
 
 func (g *GitRepo) Commits() ([]*object.Commit, error) {
-	ci, err := g.r.Log(&git.LogOptions{From: g.h})
+	return g.CommitsMatching(CommitFilter{})
+}
+
+// CommitsMatching is like Commits, but only returns commits that match f.
+func (g *GitRepo) CommitsMatching(f CommitFilter) ([]*object.Commit, error) {
+	ci, err := g.FilteredCommits(f)
 	if err != nil {
-		return nil, fmt.Errorf("commits from ref: %w", err)
+		return nil, err
 	}
 
 	commits := []*object.Commit{}
@@ -127,29 +110,94 @@ func (g *GitRepo) LastCommit() (*object.Commit, error) {
 	return c, nil
 }
 
+// FileContent returns the file at path decoded to UTF-8, or a note if
+// it's binary.
 func (g *GitRepo) FileContent(path string) (string, error) {
+	t, err := g.FileContentLimit(path, -1)
+	if err != nil {
+		return "", err
+	}
+	return t.Content, nil
+}
+
+// FileText is a file's content, decoded to UTF-8 for display.
+type FileText struct {
+	Content string
+	// Truncated is set if the file was cut short.
+	Truncated bool
+	// Encoding is what the file was decoded from, if it wasn't UTF-8.
+	Encoding string
+}
+
+// FileContentLimit is like FileContent, but reads at most limit bytes,
+// or everything if limit is negative. Truncated content ends at the last
+// complete line. The encoding comes from the file's byte order mark, its
+// working-tree-encoding attribute, or a guess.
+func (g *GitRepo) FileContentLimit(path string, limit int64) (*FileText, error) {
 	c, err := g.r.CommitObject(g.h)
 	if err != nil {
-		return "", fmt.Errorf("commit object: %w", err)
+		return nil, fmt.Errorf("commit object: %w", err)
 	}
 
 	tree, err := c.Tree()
 	if err != nil {
-		return "", fmt.Errorf("file tree: %w", err)
+		return nil, fmt.Errorf("file tree: %w", err)
 	}
 
 	file, err := tree.File(path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	isbin, _ := file.IsBinary()
+	r, err := file.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
 
-	if !isbin {
-		return file.Contents()
-	} else {
-		return "Not displaying binary file", nil
+	truncated := limit >= 0 && file.Size > limit
+	if limit < 0 {
+		limit = file.Size
+	}
+	b, err := io.ReadAll(io.LimitReader(r, limit))
+	if err != nil {
+		return nil, err
 	}
+
+	attrs := newAttrReader(tree).get(path)
+	te, ok := detectEncoding(b, attrs["working-tree-encoding"])
+	if !ok {
+		return &FileText{Content: "Not displaying binary file"}, nil
+	}
+
+	content := te.decode(b)
+	if truncated {
+		if i := strings.LastIndexByte(content, '\n'); i >= 0 {
+			content = content[:i+1]
+		}
+	}
+
+	return &FileText{
+		Content:   content,
+		Truncated: truncated,
+		Encoding:  te.name,
+	}, nil
+}
+
+// File returns the file at path, for callers that want to stream its
+// blob rather than read it into memory.
+func (g *GitRepo) File(path string) (*object.File, error) {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return nil, fmt.Errorf("commit object: %w", err)
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("file tree: %w", err)
+	}
+
+	return tree.File(path)
 }
 
 func (g *GitRepo) Tags() ([]*TagReference, error) {
@@ -161,20 +209,11 @@ func (g *GitRepo) Tags() ([]*TagReference, error) {
 	tags := make([]*TagReference, 0)
 
 	if err := iter.ForEach(func(ref *plumbing.Reference) error {
-		obj, err := g.r.TagObject(ref.Hash())
-		switch err {
-		case nil:
-			tags = append(tags, &TagReference{
-				ref: ref,
-				tag: obj,
-			})
-		case plumbing.ErrObjectNotFound:
-			tags = append(tags, &TagReference{
-				ref: ref,
-			})
-		default:
+		t, err := g.tagReference(ref)
+		if err != nil {
 			return err
 		}
+		tags = append(tags, t)
 		return nil
 	}); err != nil {
 		return nil, err
@@ -185,6 +224,35 @@ func (g *GitRepo) Tags() ([]*TagReference, error) {
 	return tags, nil
 }
 
+// Tag looks up a single tag by its short name.
+func (g *GitRepo) Tag(name string) (*TagReference, error) {
+	ref, err := g.r.Tag(name)
+	if err != nil {
+		return nil, fmt.Errorf("tag %s: %w", name, err)
+	}
+
+	return g.tagReference(ref)
+}
+
+func (g *GitRepo) tagReference(ref *plumbing.Reference) (*TagReference, error) {
+	t := &TagReference{ref: ref}
+
+	obj, err := g.r.TagObject(ref.Hash())
+	switch err {
+	case nil:
+		t.tag = obj
+		// Tags can point at trees and blobs too; those just don't
+		// get a commit.
+		t.commit, _ = obj.Commit()
+	case plumbing.ErrObjectNotFound:
+		t.commit, _ = g.r.CommitObject(ref.Hash())
+	default:
+		return nil, err
+	}
+
+	return t, nil
+}
+
 func (g *GitRepo) Branches() ([]*plumbing.Reference, error) {
 	bi, err := g.r.Branches()
 	if err != nil {
@@ -342,3 +410,45 @@ func (t *TagReference) Message() string {
 	}
 	return ""
 }
+
+// Tagger returns who created an annotated tag, or nil for lightweight
+// tags.
+func (t *TagReference) Tagger() *object.Signature {
+	if t.tag != nil {
+		return &t.tag.Tagger
+	}
+	return nil
+}
+
+// Date is when the tag was created, or the date of the tagged commit for
+// lightweight tags.
+func (t *TagReference) Date() time.Time {
+	if t.tag != nil {
+		return t.tag.Tagger.When
+	}
+	if t.commit != nil {
+		return t.commit.Committer.When
+	}
+	return time.Time{}
+}
+
+// Target returns the hash of the tagged commit, or of whatever object an
+// annotated tag points at if it isn't a commit.
+func (t *TagReference) Target() string {
+	if t.commit != nil {
+		return t.commit.Hash.String()
+	}
+	if t.tag != nil {
+		return t.tag.Target.String()
+	}
+	return t.ref.Hash().String()
+}
+
+// Commit returns the tagged commit, if there is one.
+func (t *TagReference) Commit() *object.Commit {
+	return t.commit
+}
+
+func (t *TagReference) IsAnnotated() bool {
+	return t.tag != nil
+}
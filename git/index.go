@@ -0,0 +1,616 @@
+package git
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"git.icyphox.sh/legit/cache"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Index is a search index of the main branch of many repositories, kept
+// on disk with a file per repository. Repositories are only reindexed
+// when their main branch moves, and then only the files and commits that
+// are new. Only a summary of each repository stays in memory; the rest is
+// read back from disk when it's searched.
+type Index struct {
+	dir          string
+	maxFileBytes int64
+
+	// updating serialises updates, so a repository isn't indexed twice
+	// at once.
+	updating sync.Mutex
+
+	mu    sync.Mutex
+	heads map[string]indexHead
+
+	// loaded holds the last few repositories read back from disk.
+	loaded *cache.LRU[string, *repoIndex]
+}
+
+// indexedRepos is how many repositories' indexes are kept in memory.
+const indexedRepos = 16
+
+// indexHead is what's indexed for a repository, written ahead of its
+// repoIndex so it can be read on its own.
+type indexHead struct {
+	Name   string
+	Path   string
+	Desc   string
+	Branch string
+	// Commit is the tip of Branch that was indexed.
+	Commit string
+}
+
+// repoIndex is what's stored for a repository. It's never changed once
+// built; updates replace it.
+type repoIndex struct {
+	indexHead
+	Files   []indexedFile
+	Commits []indexedCommit
+	// Trigrams are the sorted trigrams of the lowercased content of each
+	// text blob, by hash.
+	Trigrams map[string][]uint32
+}
+
+type indexedFile struct {
+	Path string
+	Blob string
+}
+
+type indexedCommit struct {
+	Hash    string
+	Parents []string
+	Message string
+	Author  string
+	When    time.Time
+}
+
+// OpenIndex opens the index in dir, creating the directory if need be.
+// Files over maxFileBytes aren't indexed. Whatever was indexed before is
+// searchable straight away.
+func OpenIndex(dir string, maxFileBytes int64) (*Index, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating index: %w", err)
+	}
+	ix := &Index{
+		dir:          dir,
+		maxFileBytes: maxFileBytes,
+		heads:        map[string]indexHead{},
+		loaded:       cache.New[string, *repoIndex](indexedRepos),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading index: %w", err)
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".gob") {
+			continue
+		}
+		if head, ok := ix.readHead(filepath.Join(dir, e.Name())); ok {
+			ix.heads[head.Name] = head
+		}
+	}
+	return ix, nil
+}
+
+func (ix *Index) file(name string) string {
+	return filepath.Join(ix.dir, url.PathEscape(name)+".gob")
+}
+
+func (ix *Index) readHead(file string) (indexHead, bool) {
+	var head indexHead
+	f, err := os.Open(file)
+	if err != nil {
+		return head, false
+	}
+	defer f.Close()
+
+	if err := gob.NewDecoder(f).Decode(&head); err != nil {
+		log.Printf("index: reading %s: %s", file, err)
+		return head, false
+	}
+	return head, true
+}
+
+// get returns the index of repository name, from memory or disk.
+func (ix *Index) get(name string) *repoIndex {
+	if ri, ok := ix.loaded.Get(name); ok {
+		return ri
+	}
+
+	f, err := os.Open(ix.file(name))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	// The head isn't part of the encoded repoIndex, being unexported.
+	ri := &repoIndex{}
+	dec := gob.NewDecoder(f)
+	if err := dec.Decode(&ri.indexHead); err != nil {
+		log.Printf("index: reading %s: %s", name, err)
+		return nil
+	}
+	if err := dec.Decode(ri); err != nil {
+		log.Printf("index: reading %s: %s", name, err)
+		return nil
+	}
+
+	ix.loaded.Add(name, ri)
+	return ri
+}
+
+func (ix *Index) put(ri *repoIndex) error {
+	tmp, err := os.CreateTemp(ix.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := gob.NewEncoder(tmp)
+	if err := enc.Encode(ri.indexHead); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := enc.Encode(ri); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), ix.file(ri.Name)); err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	ix.heads[ri.Name] = ri.indexHead
+	ix.mu.Unlock()
+	ix.loaded.Add(ri.Name, ri)
+	return nil
+}
+
+// Update brings the index of repository name, at path, up to date with
+// the first of branches it has.
+func (ix *Index) Update(name, path, desc string, branches []string) error {
+	ix.updating.Lock()
+	defer ix.updating.Unlock()
+
+	g, err := Open(path, "")
+	if err != nil {
+		return err
+	}
+	branch, err := g.FindMainBranch(branches)
+	if err != nil {
+		return err
+	}
+	if g, err = Open(path, branch); err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	head, ok := ix.heads[name]
+	ix.mu.Unlock()
+	if ok && head.Commit == g.h.String() && head.Branch == branch && head.Path == path && head.Desc == desc {
+		return nil
+	}
+
+	old := ix.get(name)
+	if old == nil {
+		old = &repoIndex{}
+	}
+	if old.Commit == g.h.String() && old.Branch == branch && old.Path == path {
+		ri := *old
+		ri.Desc = desc
+		return ix.put(&ri)
+	}
+
+	ri := &repoIndex{
+		indexHead: indexHead{
+			Name:   name,
+			Path:   path,
+			Desc:   desc,
+			Branch: branch,
+			Commit: g.h.String(),
+		},
+		Trigrams: map[string][]uint32{},
+	}
+	if err := ix.indexFiles(g, ri, old); err != nil {
+		return fmt.Errorf("indexing %s: %w", name, err)
+	}
+	if err := ix.indexCommits(g, ri, old); err != nil {
+		return fmt.Errorf("indexing %s: %w", name, err)
+	}
+	return ix.put(ri)
+}
+
+func (ix *Index) indexFiles(g *GitRepo, ri, old *repoIndex) error {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return fmt.Errorf("commit object: %w", err)
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return fmt.Errorf("file tree: %w", err)
+	}
+	attrs := newAttrReader(tree)
+
+	files := tree.Files()
+	defer files.Close()
+	for {
+		f, err := files.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !f.Mode.IsFile() || (ix.maxFileBytes > 0 && f.Size > ix.maxFileBytes) {
+			continue
+		}
+
+		// Blobs seen before, here or last time, needn't be read again.
+		hash := f.Hash.String()
+		if _, ok := ri.Trigrams[hash]; !ok {
+			if t, ok := old.Trigrams[hash]; ok {
+				ri.Trigrams[hash] = t
+			} else {
+				content, text, err := readText(f, attrs)
+				if err != nil {
+					return err
+				}
+				// Binary files are only found by name.
+				var t []uint32
+				if text {
+					t = trigrams(strings.ToLower(content))
+				}
+				ri.Trigrams[hash] = t
+			}
+		}
+		ri.Files = append(ri.Files, indexedFile{Path: f.Name, Blob: hash})
+	}
+}
+
+// readText reads and decodes f, returning false if it's binary.
+func readText(f *object.File, attrs *attrReader) (string, bool, error) {
+	r, err := f.Reader()
+	if err != nil {
+		return "", false, err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", false, err
+	}
+
+	te, ok := detectEncoding(b, attrs.get(f.Name)["working-tree-encoding"])
+	if !ok {
+		return "", false, nil
+	}
+	return te.decode(b), true, nil
+}
+
+// indexCommits indexes the history of the branch. Only commits that
+// weren't indexed before are read from the repository; the walk carries
+// on through the old index from there, which drops anything no longer on
+// the branch.
+func (ix *Index) indexCommits(g *GitRepo, ri, old *repoIndex) error {
+	known := map[string]indexedCommit{}
+	for _, c := range old.Commits {
+		known[c.Hash] = c
+	}
+
+	seen := map[string]bool{}
+	queue := []string{g.h.String()}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+
+		ic, ok := known[h]
+		if !ok {
+			c, err := g.r.CommitObject(plumbing.NewHash(h))
+			if err != nil {
+				return fmt.Errorf("commit %s: %w", h, err)
+			}
+			ic = indexedCommit{
+				Hash:    h,
+				Message: c.Message,
+				Author:  c.Author.Name,
+				When:    c.Author.When,
+			}
+			for _, p := range c.ParentHashes {
+				ic.Parents = append(ic.Parents, p.String())
+			}
+		}
+		ri.Commits = append(ri.Commits, ic)
+		queue = append(queue, ic.Parents...)
+	}
+
+	sort.SliceStable(ri.Commits, func(i, j int) bool {
+		return ri.Commits[i].When.After(ri.Commits[j].When)
+	})
+	return nil
+}
+
+// Prune drops repositories other than those in keep from the index.
+func (ix *Index) Prune(keep []string) {
+	ix.updating.Lock()
+	defer ix.updating.Unlock()
+
+	entries, err := os.ReadDir(ix.dir)
+	if err != nil {
+		log.Printf("index: %s", err)
+		return
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".gob")
+		if !ok {
+			continue
+		}
+		if name, err = url.PathUnescape(name); err != nil || slices.Contains(keep, name) {
+			continue
+		}
+
+		ix.mu.Lock()
+		delete(ix.heads, name)
+		ix.mu.Unlock()
+		ix.loaded.Remove(name)
+		if err := os.Remove(filepath.Join(ix.dir, e.Name())); err != nil {
+			log.Printf("index: %s", err)
+		}
+	}
+}
+
+// trigrams returns the distinct three-byte sequences in s, sorted.
+func trigrams(s string) []uint32 {
+	set := map[uint32]bool{}
+	for i := 0; i+3 <= len(s); i++ {
+		set[uint32(s[i])<<16|uint32(s[i+1])<<8|uint32(s[i+2])] = true
+	}
+
+	t := make([]uint32, 0, len(set))
+	for g := range set {
+		t = append(t, g)
+	}
+	slices.Sort(t)
+	return t
+}
+
+// hasTrigrams reports whether the sorted set t has all of want.
+func hasTrigrams(t, want []uint32) bool {
+	for _, g := range want {
+		if _, ok := slices.BinarySearch(t, g); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IndexResults is what a search of the index found.
+type IndexResults struct {
+	Repos   []IndexRepo
+	Commits []IndexCommit
+	Files   []IndexFile
+	// Truncated is set if there were more commits or files than the
+	// limit, or the search ran out of time.
+	Truncated bool
+}
+
+type IndexRepo struct {
+	Name string
+	Desc string
+}
+
+type IndexCommit struct {
+	Repo    string
+	Hash    string
+	Subject string
+	Author  string
+	When    time.Time
+}
+
+// IndexFile is a file whose path or content matched, with the first few
+// matching lines.
+type IndexFile struct {
+	Repo   string
+	Branch string
+	Path   string
+	Lines  []SearchLine
+}
+
+// indexFileLines is how many matching lines are shown per file.
+const indexFileLines = 3
+
+// Search looks for q, ignoring case, in the names and descriptions,
+// commit messages and files of the indexed repositories, as they were
+// last indexed. At most limit commits, the newest, and limit files are
+// returned.
+func (ix *Index) Search(ctx context.Context, q string, limit int) *IndexResults {
+	ix.mu.Lock()
+	heads := make([]indexHead, 0, len(ix.heads))
+	for _, head := range ix.heads {
+		heads = append(heads, head)
+	}
+	ix.mu.Unlock()
+	sort.Slice(heads, func(i, j int) bool {
+		return heads[i].Name < heads[j].Name
+	})
+
+	res := &IndexResults{}
+	lq := strings.ToLower(q)
+	re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(q))
+
+	for _, head := range heads {
+		if strings.Contains(strings.ToLower(head.Name), lq) || strings.Contains(strings.ToLower(head.Desc), lq) {
+			res.Repos = append(res.Repos, IndexRepo{Name: head.Name, Desc: head.Desc})
+		}
+	}
+
+	// Content can only be narrowed down by trigrams for queries of three
+	// bytes or more; shorter ones just match paths.
+	want := trigrams(lq)
+	for _, head := range heads {
+		if ctx.Err() != nil {
+			res.Truncated = true
+			break
+		}
+		ri := ix.get(head.Name)
+		if ri == nil {
+			continue
+		}
+
+		searchCommits(ctx, ri, lq, limit, res)
+		if len(res.Files) < limit {
+			ix.searchFiles(ctx, ri, lq, re, want, limit, res)
+		} else {
+			res.Truncated = true
+		}
+	}
+
+	sort.SliceStable(res.Commits, func(i, j int) bool {
+		return res.Commits[i].When.After(res.Commits[j].When)
+	})
+	if len(res.Commits) > limit {
+		res.Commits = res.Commits[:limit]
+		res.Truncated = true
+	}
+	return res
+}
+
+// searchCommits adds up to limit of the newest commits in ri whose
+// messages hold lq; the newest limit overall are among them.
+func searchCommits(ctx context.Context, ri *repoIndex, lq string, limit int, res *IndexResults) {
+	found := 0
+	for _, c := range ri.Commits {
+		if ctx.Err() != nil {
+			res.Truncated = true
+			return
+		}
+		if !strings.Contains(strings.ToLower(c.Message), lq) {
+			continue
+		}
+		if found == limit {
+			res.Truncated = true
+			return
+		}
+		found++
+
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		res.Commits = append(res.Commits, IndexCommit{
+			Repo:    ri.Name,
+			Hash:    c.Hash,
+			Subject: subject,
+			Author:  c.Author,
+			When:    c.When,
+		})
+	}
+}
+
+func (ix *Index) searchFiles(ctx context.Context, ri *repoIndex, lq string, re *regexp.Regexp, want []uint32, limit int, res *IndexResults) {
+	var g *GitRepo
+	var attrs *attrReader
+	for _, f := range ri.Files {
+		if ctx.Err() != nil {
+			return
+		}
+
+		byPath := strings.Contains(strings.ToLower(f.Path), lq)
+		byContent := len(want) > 0 && hasTrigrams(ri.Trigrams[f.Blob], want)
+		if !byPath && !byContent {
+			continue
+		}
+		if len(res.Files) >= limit {
+			res.Truncated = true
+			return
+		}
+
+		file := IndexFile{Repo: ri.Name, Branch: ri.Branch, Path: f.Path}
+		if byContent {
+			if g == nil {
+				var err error
+				if g, attrs, err = openIndexed(ri); err != nil {
+					log.Printf("index: %s", err)
+					return
+				}
+			}
+			file.Lines = g.matchingLines(f, attrs.get(f.Path)["working-tree-encoding"], re)
+		}
+		// Trigrams can match where the text doesn't.
+		if byPath || len(file.Lines) > 0 {
+			res.Files = append(res.Files, file)
+		}
+	}
+}
+
+// openIndexed opens the repository at the commit that was indexed.
+func openIndexed(ri *repoIndex) (*GitRepo, *attrReader, error) {
+	g, err := Open(ri.Path, ri.Commit)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return nil, nil, fmt.Errorf("commit object: %w", err)
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("file tree: %w", err)
+	}
+	return g, newAttrReader(tree), nil
+}
+
+// matchingLines returns the first few lines of f that match re, decoding
+// it as readText does.
+func (g *GitRepo) matchingLines(f indexedFile, attr string, re *regexp.Regexp) []SearchLine {
+	blob, err := g.r.BlobObject(plumbing.NewHash(f.Blob))
+	if err != nil {
+		log.Printf("index: %s", err)
+		return nil
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+	te, ok := detectEncoding(b, attr)
+	if !ok {
+		return nil
+	}
+
+	var lines []SearchLine
+	for i, l := range strings.Split(te.decode(b), "\n") {
+		if locs := re.FindAllStringIndex(l, -1); locs != nil {
+			lines = append(lines, matchLine(i, l, locs))
+			if len(lines) == indexFileLines {
+				break
+			}
+		}
+	}
+	return lines
+}
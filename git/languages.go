@@ -0,0 +1,162 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"path"
+	"sort"
+
+	"git.icyphox.sh/legit/cache"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Language is how much of a tree is written in a language.
+type Language struct {
+	Name  string
+	Bytes int64
+	// Percent is the share of all the counted bytes, to one decimal
+	// place.
+	Percent float64
+	// Hue picks a colour for the language, the same every time.
+	Hue uint32
+}
+
+// Lexers for data and prose, which aren't counted, as on GitHub.
+var uncountedLanguages = map[string]bool{
+	"plaintext":        true,
+	"markdown":         true,
+	"reStructuredText": true,
+	"Org Mode":         true,
+	"JSON":             true,
+	"YAML":             true,
+	"TOML":             true,
+	"XML":              true,
+	"INI":              true,
+	"Diff":             true,
+}
+
+// Files that chroma gets wrong by their names.
+var uncountedFiles = map[string]bool{
+	"go.mod":  true,
+	"go.work": true,
+}
+
+// languageCache holds breakdowns by tree hash; everything they depend on,
+// .gitattributes included, is in the tree.
+var languageCache = cache.New[plumbing.Hash, []Language](256)
+
+// Languages breaks down the files at the current commit by language,
+// going by the lexers chroma picks for their names, largest first.
+// Vendored and generated files are left out, as marked by the
+// linguist-vendored and linguist-generated attributes or guessed from
+// their paths; linguist-language overrides the language of a file, and
+// linguist-documentation leaves it out.
+func (g *GitRepo) Languages() ([]Language, error) {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return nil, fmt.Errorf("commit object: %w", err)
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("file tree: %w", err)
+	}
+
+	if langs, ok := languageCache.Get(tree.Hash); ok {
+		return langs, nil
+	}
+
+	attrs := newAttrReader(tree)
+	bytes := map[string]int64{}
+	var total int64
+
+	files := tree.Files()
+	defer files.Close()
+	for {
+		f, err := files.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !f.Mode.IsFile() {
+			continue
+		}
+
+		a := attrs.get(f.Name)
+		if skipLanguage(f.Name, a) {
+			continue
+		}
+
+		name := a["linguist-language"]
+		if name != "" {
+			if l := lexers.Get(name); l != nil {
+				name = l.Config().Name
+			}
+		} else if uncountedFiles[path.Base(f.Name)] {
+			continue
+		} else if l := lexers.Match(path.Base(f.Name)); l != nil {
+			name = l.Config().Name
+		}
+		if name == "" || uncountedLanguages[name] {
+			continue
+		}
+
+		bytes[name] += f.Size
+		total += f.Size
+	}
+
+	langs := []Language{}
+	for name, n := range bytes {
+		h := fnv.New32a()
+		h.Write([]byte(name))
+		langs = append(langs, Language{
+			Name:    name,
+			Bytes:   n,
+			Percent: math.Round(float64(n)/float64(total)*1000) / 10,
+			Hue:     h.Sum32() % 360,
+		})
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if langs[i].Bytes != langs[j].Bytes {
+			return langs[i].Bytes > langs[j].Bytes
+		}
+		return langs[i].Name < langs[j].Name
+	})
+
+	languageCache.Add(tree.Hash, langs)
+	return langs, nil
+}
+
+// CachedLanguages is Languages, but only if the breakdown has already
+// been worked out; it never walks the tree.
+func (g *GitRepo) CachedLanguages() ([]Language, bool) {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return nil, false
+	}
+	return languageCache.Get(c.TreeHash)
+}
+
+// skipLanguage reports whether the file at p, with attributes a, is left
+// out of the breakdown. The attributes win over guesses from the path.
+func skipLanguage(p string, a map[string]string) bool {
+	if a["linguist-documentation"] == "true" {
+		return true
+	}
+
+	vendored := isVendored(p)
+	if v, ok := a["linguist-vendored"]; ok {
+		vendored = v == "true"
+	}
+	generated := isGeneratedName(p)
+	if v, ok := a["linguist-generated"]; ok {
+		generated = v == "true"
+	}
+	return vendored || generated
+}
@@ -0,0 +1,124 @@
+package git
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"git.icyphox.sh/legit/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// LastCommit is the most recent commit to touch a tree entry.
+type LastCommit struct {
+	Hash    string
+	Subject string
+	Author  string
+	When    time.Time
+}
+
+// lastCommitCache maps a directory, by its tree hash, the commit that last
+// changed it and the .mailmap in use, to the last commits of its entries.
+// Everything before that commit is fixed history, so the answer never goes
+// stale.
+var lastCommitCache = cache.New[string, map[string]*LastCommit](1024)
+
+// lastCommits finds the last commit to touch each entry of the directory
+// dir, whose tree at g.h is t. It makes a single walk down the first-parent
+// history, comparing entry hashes between each commit and its parent, so
+// changes that came in through a merge are credited to the merge.
+func (g *GitRepo) lastCommits(dir string, t *object.Tree) (map[string]*LastCommit, error) {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return nil, fmt.Errorf("commit object: %w", err)
+	}
+
+	pending := make(map[string]object.TreeEntry, len(t.Entries))
+	for _, e := range t.Entries {
+		pending[e.Name] = e
+	}
+	found := make(map[string]*LastCommit, len(t.Entries))
+
+	mm, err := g.Mailmap()
+	if err != nil {
+		log.Println(err)
+	}
+
+	cur := t
+	var key string
+	for len(pending) > 0 {
+		var parent *object.Commit
+		var pt *object.Tree
+		if c.NumParents() > 0 {
+			parent, err = c.Parent(0)
+			if err != nil {
+				return nil, fmt.Errorf("parent commit: %w", err)
+			}
+			pt, err = dirTree(parent, dir)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if pt == nil || pt.Hash != cur.Hash {
+			// The first commit to change the directory at all pins
+			// down the rest of the walk.
+			if key == "" {
+				key = t.Hash.String() + ":" + c.Hash.String() + ":" + mm.key()
+				if v, ok := lastCommitCache.Get(key); ok {
+					return v, nil
+				}
+			}
+
+			lc := newLastCommit(c, mm)
+			for name, te := range pending {
+				if pt != nil {
+					if e, err := pt.FindEntry(name); err == nil && e.Hash == te.Hash && e.Mode == te.Mode {
+						continue
+					}
+				}
+				found[name] = lc
+				delete(pending, name)
+			}
+		}
+
+		if parent == nil {
+			break
+		}
+		c, cur = parent, pt
+	}
+
+	if key != "" {
+		lastCommitCache.Add(key, found)
+	}
+	return found, nil
+}
+
+// dirTree returns the tree of dir in c, or nil if it doesn't exist there.
+func dirTree(c *object.Commit, dir string) (*object.Tree, error) {
+	t, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("file tree: %w", err)
+	}
+	if dir == "" {
+		return t, nil
+	}
+
+	e, err := t.FindEntry(dir)
+	if err != nil || e.Mode != filemode.Dir {
+		return nil, nil
+	}
+	return t.Tree(dir)
+}
+
+func newLastCommit(c *object.Commit, mm *Mailmap) *LastCommit {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return &LastCommit{
+		Hash:    c.Hash.String(),
+		Subject: subject,
+		Author:  mm.Map(c.Author).Name,
+		When:    c.Author.When,
+	}
+}
@@ -0,0 +1,160 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// CommitFilter picks commits out of a history. Zero fields match
+// everything.
+type CommitFilter struct {
+	// Author and Committer match part of a name or email, ignoring case.
+	Author    string
+	Committer string
+	// Message matches part of the commit message ignoring case or, with
+	// MessageRegexp, is a regular expression it has to match.
+	Message       string
+	MessageRegexp bool
+	// Since and Until bound the commit date, like git log's options of
+	// the same name.
+	Since time.Time
+	Until time.Time
+	// NoMerges leaves out commits with more than one parent.
+	NoMerges bool
+}
+
+// IsZero reports whether f lets every commit through.
+func (f CommitFilter) IsZero() bool {
+	return f == CommitFilter{}
+}
+
+// FilteredCommits iterates over the history of the current commit, newest
+// first, skipping commits that don't match f. Authors and committers are
+// matched as the repo's .mailmap maps them, but the commits are left as
+// they are, so their signatures still verify.
+func (g *GitRepo) FilteredCommits(f CommitFilter) (object.CommitIter, error) {
+	mm, err := g.Mailmap()
+	if err != nil {
+		log.Println(err)
+	}
+
+	match, err := f.matcher(mm)
+	if err != nil {
+		return nil, err
+	}
+
+	ci, err := g.r.Log(&git.LogOptions{From: g.h})
+	if err != nil {
+		return nil, fmt.Errorf("commits from ref: %w", err)
+	}
+	return &filterIter{CommitIter: ci, match: match}, nil
+}
+
+// CommitsPage returns up to n of the commits matching f after skipping
+// the first skip, and whether there are any more. History is only walked
+// as far as it takes to find them.
+func (g *GitRepo) CommitsPage(f CommitFilter, skip, n int) ([]*object.Commit, bool, error) {
+	ci, err := g.FilteredCommits(f)
+	if err != nil {
+		return nil, false, err
+	}
+
+	commits := []*object.Commit{}
+	var more bool
+	err = ci.ForEach(func(c *object.Commit) error {
+		switch {
+		case skip > 0:
+			skip--
+		case len(commits) < n:
+			commits = append(commits, c)
+		default:
+			more = true
+			return storer.ErrStop
+		}
+		return nil
+	})
+	return commits, more, err
+}
+
+func (f CommitFilter) matcher(mm *Mailmap) (func(*object.Commit) bool, error) {
+	var re *regexp.Regexp
+	if f.Message != "" {
+		expr := "(?i)" + regexp.QuoteMeta(f.Message)
+		if f.MessageRegexp {
+			expr = f.Message
+		}
+		var err error
+		if re, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBadQuery, err)
+		}
+	}
+
+	return func(c *object.Commit) bool {
+		switch {
+		case f.NoMerges && c.NumParents() > 1:
+			return false
+		case !f.Since.IsZero() && c.Committer.When.Before(f.Since):
+			return false
+		case !f.Until.IsZero() && c.Committer.When.After(f.Until):
+			return false
+		case f.Author != "" && !matchSignature(mm.Map(c.Author), f.Author):
+			return false
+		case f.Committer != "" && !matchSignature(mm.Map(c.Committer), f.Committer):
+			return false
+		case re != nil && !re.MatchString(c.Message):
+			return false
+		}
+		return true
+	}, nil
+}
+
+func matchSignature(s object.Signature, who string) bool {
+	who = strings.ToLower(who)
+	return strings.Contains(strings.ToLower(s.Name), who) ||
+		strings.Contains(strings.ToLower(s.Email), who)
+}
+
+// filterIter is a CommitIter that only yields commits that match.
+type filterIter struct {
+	object.CommitIter
+	match func(*object.Commit) bool
+}
+
+func (it *filterIter) Next() (*object.Commit, error) {
+	for {
+		c, err := it.CommitIter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if it.match(c) {
+			return c, nil
+		}
+	}
+}
+
+func (it *filterIter) ForEach(cb func(*object.Commit) error) error {
+	defer it.Close()
+	for {
+		c, err := it.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := cb(c); errors.Is(err, storer.ErrStop) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
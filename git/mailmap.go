@@ -0,0 +1,170 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"git.icyphox.sh/legit/cache"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Mailmap maps the names and emails commits were made under to canonical
+// ones, as read from a .mailmap file; see gitmailmap(5). A nil Mailmap
+// maps everyone to themselves.
+type Mailmap struct {
+	// hash is the .mailmap blob's.
+	hash plumbing.Hash
+	// entries are keyed by the lowercased commit email.
+	entries map[string]*mailmapEntry
+}
+
+type mailmapIdentity struct {
+	name, email string
+}
+
+type mailmapEntry struct {
+	// mailmapIdentity applies whatever the commit name.
+	mailmapIdentity
+	// names are keyed by the lowercased commit name.
+	names map[string]mailmapIdentity
+}
+
+// mailmapCache holds parsed mailmaps by blob hash.
+var mailmapCache = cache.New[plumbing.Hash, *Mailmap](128)
+
+// Mailmap reads the .mailmap at HEAD, which is where git looks in a bare
+// repository. It's nil if there isn't one, and callers carry on with the
+// nil *Mailmap if it can't be read, as Map leaves signatures alone then.
+func (g *GitRepo) Mailmap() (*Mailmap, error) {
+	head, err := g.r.Head()
+	if err != nil {
+		// Nothing's been committed yet.
+		return nil, nil
+	}
+
+	c, err := g.r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("commit object: %w", err)
+	}
+
+	f, err := c.File(".mailmap")
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading .mailmap: %w", err)
+	}
+
+	if m, ok := mailmapCache.Get(f.Hash); ok {
+		return m, nil
+	}
+
+	content, err := f.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("reading .mailmap: %w", err)
+	}
+
+	m := parseMailmap(content)
+	m.hash = f.Hash
+	mailmapCache.Add(f.Hash, m)
+	return m, nil
+}
+
+// parseMailmap reads lines of the forms
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+//
+// Later lines win, and lines it can't make sense of are skipped.
+func parseMailmap(content string) *Mailmap {
+	m := &Mailmap{entries: map[string]*mailmapEntry{}}
+
+	for _, l := range strings.Split(content, "\n") {
+		l, _, _ = strings.Cut(l, "#")
+
+		properName, properEmail, rest, ok := cutIdentity(l)
+		if !ok {
+			continue
+		}
+		commitName, commitEmail, _, ok := cutIdentity(rest)
+		if !ok {
+			// Only one address: it's the commit's, and just the name
+			// changes.
+			commitName, commitEmail, properEmail = "", properEmail, ""
+		}
+		if commitEmail == "" {
+			continue
+		}
+
+		e, ok := m.entries[strings.ToLower(commitEmail)]
+		if !ok {
+			e = &mailmapEntry{names: map[string]mailmapIdentity{}}
+			m.entries[strings.ToLower(commitEmail)] = e
+		}
+
+		proper := mailmapIdentity{name: properName, email: properEmail}
+		if commitName != "" {
+			e.names[strings.ToLower(commitName)] = proper
+			continue
+		}
+		if proper.name != "" {
+			e.name = proper.name
+		}
+		if proper.email != "" {
+			e.email = proper.email
+		}
+	}
+
+	return m
+}
+
+// cutIdentity splits "Name <email> rest" into its parts. The name may be
+// empty.
+func cutIdentity(s string) (name, email, rest string, ok bool) {
+	name, s, ok = strings.Cut(s, "<")
+	if !ok {
+		return "", "", "", false
+	}
+	email, rest, ok = strings.Cut(s, ">")
+	if !ok {
+		return "", "", "", false
+	}
+	return strings.TrimSpace(name), strings.TrimSpace(email), rest, true
+}
+
+// Map returns s with its name and email made canonical. Emails and names
+// are matched ignoring case, as git does.
+func (m *Mailmap) Map(s object.Signature) object.Signature {
+	if m == nil {
+		return s
+	}
+
+	e, ok := m.entries[strings.ToLower(s.Email)]
+	if !ok {
+		return s
+	}
+
+	id := e.mailmapIdentity
+	if n, ok := e.names[strings.ToLower(s.Name)]; ok {
+		id = n
+	}
+	if id.name != "" {
+		s.Name = id.name
+	}
+	if id.email != "" {
+		s.Email = id.email
+	}
+	return s
+}
+
+// key tells mailmaps apart in cache keys.
+func (m *Mailmap) key() string {
+	if m == nil {
+		return ""
+	}
+	return m.hash.String()
+}
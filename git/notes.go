@@ -0,0 +1,164 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"git.icyphox.sh/legit/cache"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// defaultNotesRef is where git notes go unless told otherwise.
+const defaultNotesRef = "refs/notes/commits"
+
+// Note is a git note attached to a commit.
+type Note struct {
+	// Ref is the notes ref it came from, without the refs/notes/ prefix.
+	Ref     string
+	Message string
+}
+
+// Notes reads notes from a set of notes refs.
+type Notes struct {
+	g    *GitRepo
+	refs []notesRef
+}
+
+type notesRef struct {
+	name string
+	// blobs maps commit hashes to their notes.
+	blobs map[plumbing.Hash]plumbing.Hash
+}
+
+// notesCache holds notes trees, flattened into notesRef.blobs, by the
+// hash of the notes commit.
+var notesCache = cache.New[plumbing.Hash, map[plumbing.Hash]plumbing.Hash](64)
+
+// expandNotesRef makes a full ref name out of the shorthand git accepts
+// for notes refs: "review" and "notes/review" both mean
+// refs/notes/review.
+func expandNotesRef(ref string) string {
+	switch {
+	case strings.HasPrefix(ref, "refs/notes/"):
+		return ref
+	case strings.HasPrefix(ref, "notes/"):
+		return "refs/" + ref
+	}
+	return "refs/notes/" + ref
+}
+
+// Notes reads the notes refs in refs, after refs/notes/commits. Refs that
+// don't exist in the repo are skipped.
+func (g *GitRepo) Notes(refs []string) (*Notes, error) {
+	n := &Notes{g: g}
+	seen := map[string]bool{}
+	for _, ref := range append([]string{defaultNotesRef}, refs...) {
+		ref = expandNotesRef(ref)
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		r, err := g.r.Reference(plumbing.ReferenceName(ref), true)
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", ref, err)
+		}
+
+		blobs, err := g.notesBlobs(r.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", ref, err)
+		}
+		n.refs = append(n.refs, notesRef{
+			name:  strings.TrimPrefix(ref, "refs/notes/"),
+			blobs: blobs,
+		})
+	}
+	return n, nil
+}
+
+// notesBlobs flattens the tree of the notes commit h. Notes are named
+// after the commits they annotate, split into directories by leading
+// hex digits once there are many of them.
+func (g *GitRepo) notesBlobs(h plumbing.Hash) (map[plumbing.Hash]plumbing.Hash, error) {
+	if blobs, ok := notesCache.Get(h); ok {
+		return blobs, nil
+	}
+
+	c, err := g.r.CommitObject(h)
+	if err != nil {
+		return nil, fmt.Errorf("commit object: %w", err)
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("file tree: %w", err)
+	}
+
+	blobs := map[plumbing.Hash]plumbing.Hash{}
+	files := tree.Files()
+	defer files.Close()
+	for {
+		f, err := files.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.ReplaceAll(f.Name, "/", "")
+		if len(name) != 40 || !plumbing.IsHash(name) {
+			continue
+		}
+		blobs[plumbing.NewHash(name)] = f.Hash
+	}
+
+	notesCache.Add(h, blobs)
+	return blobs, nil
+}
+
+// Get returns the notes on the commit with the given hash, in the order
+// the refs were given.
+func (n *Notes) Get(commit plumbing.Hash) []Note {
+	if n == nil {
+		return nil
+	}
+
+	var notes []Note
+	for _, ref := range n.refs {
+		bh, ok := ref.blobs[commit]
+		if !ok {
+			continue
+		}
+
+		message, err := n.g.readNote(bh)
+		if err != nil {
+			continue
+		}
+
+		notes = append(notes, Note{
+			Ref:     ref.name,
+			Message: strings.TrimRight(message, "\n"),
+		})
+	}
+	return notes
+}
+
+func (g *GitRepo) readNote(h plumbing.Hash) (string, error) {
+	b, err := g.r.BlobObject(h)
+	if err != nil {
+		return "", err
+	}
+	r, err := b.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	message, err := io.ReadAll(r)
+	return string(message), err
+}
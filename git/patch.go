@@ -0,0 +1,380 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitPatch returns the patch introduced by c against its first parent,
+// along with that parent. Root commits are diffed against an empty tree
+// and get a nil parent.
+func commitPatch(c *object.Commit) (*object.Patch, *object.Commit, error) {
+	commitTree, err := c.Tree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("commit tree: %w", err)
+	}
+
+	var parent *object.Commit
+	parentTree := &object.Tree{}
+	if c.NumParents() != 0 {
+		parent, err = c.Parents().Next()
+		if err != nil {
+			return nil, nil, fmt.Errorf("parent commit: %w", err)
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return nil, nil, fmt.Errorf("parent tree: %w", err)
+		}
+	}
+
+	patch, err := parentTree.Patch(commitTree)
+	if err != nil {
+		return nil, nil, fmt.Errorf("patch: %w", err)
+	}
+
+	return patch, parent, nil
+}
+
+// CommitRange returns the commits reachable from the current ref but not
+// from base, oldest first, like `git rev-list --reverse base..ref`.
+func (g *GitRepo) CommitRange(base string) ([]*object.Commit, error) {
+	bh, err := g.r.ResolveRevision(plumbing.Revision(base))
+	if err != nil {
+		return nil, fmt.Errorf("resolving rev %s: %w", base, err)
+	}
+
+	bi, err := g.r.Log(&git.LogOptions{From: *bh})
+	if err != nil {
+		return nil, fmt.Errorf("commits from base: %w", err)
+	}
+
+	seen := map[plumbing.Hash]bool{}
+	bi.ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+
+	ci, err := g.r.Log(&git.LogOptions{From: g.h})
+	if err != nil {
+		return nil, fmt.Errorf("commits from ref: %w", err)
+	}
+
+	commits := []*object.Commit{}
+	ci.ForEach(func(c *object.Commit) error {
+		if !seen[c.Hash] {
+			commits = append(commits, c)
+		}
+		return nil
+	})
+
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+
+	return commits, nil
+}
+
+// WritePatch writes the current commit in `git format-patch` mbox format.
+func (g *GitRepo) WritePatch(w io.Writer) error {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return fmt.Errorf("commit object: %w", err)
+	}
+
+	return writeMboxPatch(w, c, 1, 1)
+}
+
+// WriteRangePatch writes every non-merge commit in base..ref as a
+// `git format-patch` series, suitable for piping into `git am`.
+func (g *GitRepo) WriteRangePatch(w io.Writer, base string) error {
+	commits, err := g.CommitRange(base)
+	if err != nil {
+		return err
+	}
+
+	series := []*object.Commit{}
+	for _, c := range commits {
+		if c.NumParents() <= 1 {
+			series = append(series, c)
+		}
+	}
+
+	for i, c := range series {
+		if err := writeMboxPatch(w, c, i+1, len(series)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteDiff writes the changes introduced by the current commit as a plain
+// unified diff.
+func (g *GitRepo) WriteDiff(w io.Writer) error {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return fmt.Errorf("commit object: %w", err)
+	}
+
+	patch, _, err := commitPatch(c)
+	if err != nil {
+		return err
+	}
+
+	return patch.Encode(w)
+}
+
+// WriteRangeDiff writes a unified diff between base and the current ref.
+// If mergeBase is set, the diff is taken from the merge base of the two
+// instead, like `git diff base...ref`.
+func (g *GitRepo) WriteRangeDiff(w io.Writer, base string, mergeBase bool) error {
+	bh, err := g.r.ResolveRevision(plumbing.Revision(base))
+	if err != nil {
+		return fmt.Errorf("resolving rev %s: %w", base, err)
+	}
+
+	from, err := g.r.CommitObject(*bh)
+	if err != nil {
+		return fmt.Errorf("base commit: %w", err)
+	}
+
+	to, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return fmt.Errorf("commit object: %w", err)
+	}
+
+	if mergeBase {
+		bases, err := from.MergeBase(to)
+		if err != nil {
+			return fmt.Errorf("merge base: %w", err)
+		}
+		if len(bases) == 0 {
+			return fmt.Errorf("no merge base between %s and %s", from.Hash, to.Hash)
+		}
+		from = bases[0]
+	}
+
+	patch, err := from.Patch(to)
+	if err != nil {
+		return fmt.Errorf("patch: %w", err)
+	}
+
+	return patch.Encode(w)
+}
+
+func writeMboxPatch(w io.Writer, c *object.Commit, n, total int) error {
+	patch, parent, err := commitPatch(c)
+	if err != nil {
+		return err
+	}
+
+	newTree, err := c.Tree()
+	if err != nil {
+		return fmt.Errorf("commit tree: %w", err)
+	}
+	oldTree := &object.Tree{}
+	if parent != nil {
+		if oldTree, err = parent.Tree(); err != nil {
+			return fmt.Errorf("parent tree: %w", err)
+		}
+	}
+
+	subject, body := splitMessage(c.Message)
+	prefix := "[PATCH]"
+	if total > 1 {
+		prefix = fmt.Sprintf("[PATCH %d/%d]", n, total)
+	}
+
+	fmt.Fprintf(w, "From %s Mon Sep 17 00:00:00 2001\n", c.Hash)
+	fmt.Fprintf(w, "From: %s <%s>\n", mime.QEncoding.Encode("utf-8", c.Author.Name), c.Author.Email)
+	fmt.Fprintf(w, "Date: %s\n", c.Author.When.Format("Mon, 2 Jan 2006 15:04:05 -0700"))
+	fmt.Fprintf(w, "Subject: %s\n", mime.QEncoding.Encode("utf-8", prefix+" "+subject))
+	fmt.Fprint(w, "MIME-Version: 1.0\n")
+	fmt.Fprint(w, "Content-Type: text/plain; charset=UTF-8\n")
+	fmt.Fprint(w, "Content-Transfer-Encoding: 8bit\n\n")
+	if body != "" {
+		fmt.Fprintf(w, "%s\n\n", body)
+	}
+
+	stats := patch.Stats()
+	fmt.Fprintf(w, "---\n%s%s\n\n", stats, statSummary(stats))
+
+	if err := encodeBinaryPatch(w, patch, oldTree, newTree); err != nil {
+		return fmt.Errorf("encoding patch: %w", err)
+	}
+
+	_, err = fmt.Fprint(w, "-- \nlegit\n\n")
+	return err
+}
+
+// encodeBinaryPatch writes p as a unified diff, like `git diff --binary`:
+// binary files get their contents as "GIT binary patch" literals, so git
+// am can apply them, rather than just a note that they differ. Their
+// contents are read from the trees p was made between.
+func encodeBinaryPatch(w io.Writer, p fdiff.Patch, oldTree, newTree *object.Tree) error {
+	enc := fdiff.NewUnifiedEncoder(w, fdiff.DefaultContextLines)
+
+	for _, fp := range p.FilePatches() {
+		if !fp.IsBinary() {
+			if err := enc.Encode(&textPatch{filePatches: []fdiff.FilePatch{fp}}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Keep the headers, but not the "Binary files differ" line
+		// they end with.
+		var buf bytes.Buffer
+		err := fdiff.NewUnifiedEncoder(&buf, fdiff.DefaultContextLines).
+			Encode(&textPatch{filePatches: []fdiff.FilePatch{fp}})
+		if err != nil {
+			return err
+		}
+		header := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+		header = header[:bytes.LastIndexByte(header, '\n')+1]
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+
+		from, to := fp.Files()
+		oldData, err := fileData(oldTree, from)
+		if err != nil {
+			return err
+		}
+		newData, err := fileData(newTree, to)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprint(w, "GIT binary patch\n")
+		if err := writeBinaryLiteral(w, newData); err != nil {
+			return err
+		}
+		if err := writeBinaryLiteral(w, oldData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fileData reads the contents of f, one side of a file patch, from t. A
+// nil f is a file that isn't there, which is empty.
+func fileData(t *object.Tree, f fdiff.File) ([]byte, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	tf, err := t.File(f.Path())
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", f.Path(), err)
+	}
+	r, err := tf.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", f.Path(), err)
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// base85 is the alphabet git encodes binary patches in.
+const base85 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+// writeBinaryLiteral writes data as a "literal" binary patch hunk: zlib
+// compressed and base85 encoded, in lines of up to 52 bytes, each led by
+// a letter giving its length.
+func writeBinaryLiteral(w io.Writer, data []byte) error {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "literal %d\n", len(data))
+	for b := z.Bytes(); len(b) > 0; {
+		n := min(len(b), 52)
+		line := b[:n]
+		b = b[n:]
+
+		if n <= 26 {
+			sb.WriteByte(byte('A' + n - 1))
+		} else {
+			sb.WriteByte(byte('a' + n - 27))
+		}
+
+		// Every four bytes, zero-padded at the end, become five
+		// characters.
+		for i := 0; i < n; i += 4 {
+			var v uint32
+			for j := i; j < i+4; j++ {
+				v <<= 8
+				if j < n {
+					v |= uint32(line[j])
+				}
+			}
+			var chunk [5]byte
+			for k := 4; k >= 0; k-- {
+				chunk[k] = base85[v%85]
+				v /= 85
+			}
+			sb.Write(chunk[:])
+		}
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// splitMessage splits a commit message into its subject, i.e. the first
+// paragraph folded onto one line, and the remaining body.
+func splitMessage(msg string) (string, string) {
+	msg = strings.TrimSpace(msg)
+	subject, body, _ := strings.Cut(msg, "\n\n")
+	subject = strings.Join(strings.Fields(subject), " ")
+	return subject, strings.TrimSpace(body)
+}
+
+func statSummary(stats object.FileStats) string {
+	var add, del int
+	for _, s := range stats {
+		add += s.Addition
+		del += s.Deletion
+	}
+
+	files := "files"
+	if len(stats) == 1 {
+		files = "file"
+	}
+
+	summary := fmt.Sprintf(" %d %s changed", len(stats), files)
+	if add > 0 || del == 0 {
+		summary += fmt.Sprintf(", %d insertion%s(+)", add, plural(add))
+	}
+	if del > 0 {
+		summary += fmt.Sprintf(", %d deletion%s(-)", del, plural(del))
+	}
+	return summary
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
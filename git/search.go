@@ -0,0 +1,230 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// SearchOptions controls a search of the tree at a commit.
+type SearchOptions struct {
+	Query string
+	// Regexp treats Query as a regular expression rather than literal
+	// text.
+	Regexp     bool
+	IgnoreCase bool
+	// Path limits the search to files matching a glob. Globs without a
+	// slash match the file name anywhere; others match from the top of
+	// the tree, with ** matching any number of directories.
+	Path string
+	// Context is the number of lines shown around each match.
+	Context int
+	// The search stops after MaxMatches matching lines. Files larger
+	// than MaxFileBytes are skipped. Zero means no limit.
+	MaxMatches   int
+	MaxFileBytes int64
+}
+
+// SearchResult is what a search found, in tree order.
+type SearchResult struct {
+	Files   []FileMatch
+	Matches int
+	// Truncated is set if the search stopped before looking at every
+	// file, because it hit MaxMatches or ran out of time.
+	Truncated bool
+}
+
+// FileMatch is a file with matching lines, grouped into runs of lines
+// with their context.
+type FileMatch struct {
+	Path    string
+	Matches int
+	Groups  [][]SearchLine
+}
+
+type SearchLine struct {
+	N     int
+	Match bool
+	// Parts are the line split into matched and unmatched text.
+	Parts []SearchPart
+}
+
+type SearchPart struct {
+	Text  string
+	Match bool
+}
+
+// ErrBadQuery is returned for queries that aren't valid regular
+// expressions.
+var ErrBadQuery = errors.New("invalid query")
+
+// Search greps the files in the tree at the current commit. It gives up
+// early, returning what it found so far, when ctx is done.
+func (g *GitRepo) Search(ctx context.Context, opts SearchOptions) (*SearchResult, error) {
+	expr := opts.Query
+	if !opts.Regexp {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if opts.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadQuery, err)
+	}
+
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return nil, fmt.Errorf("commit object: %w", err)
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("file tree: %w", err)
+	}
+
+	attrs := newAttrReader(tree)
+	res := &SearchResult{}
+
+	files := tree.Files()
+	defer files.Close()
+	for {
+		if ctx.Err() != nil {
+			res.Truncated = true
+			break
+		}
+		if opts.MaxMatches > 0 && res.Matches >= opts.MaxMatches {
+			res.Truncated = true
+			break
+		}
+
+		f, err := files.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !f.Mode.IsFile() {
+			continue
+		}
+		if opts.Path != "" && !matchGlob(opts.Path, f.Name) {
+			continue
+		}
+		if opts.MaxFileBytes > 0 && f.Size > opts.MaxFileBytes {
+			continue
+		}
+
+		fm, err := searchFile(ctx, f, re, attrs, opts, opts.MaxMatches-res.Matches)
+		if err != nil {
+			return nil, err
+		}
+		if fm != nil {
+			res.Files = append(res.Files, *fm)
+			res.Matches += fm.Matches
+		}
+	}
+
+	return res, nil
+}
+
+// searchFile looks for re in f, returning nil if it isn't there or f is
+// binary. It stops after limit matching lines, if limit is positive, or
+// when ctx is done.
+func searchFile(ctx context.Context, f *object.File, re *regexp.Regexp, attrs *attrReader, opts SearchOptions, limit int) (*FileMatch, error) {
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	te, ok := detectEncoding(b, attrs.get(f.Name)["working-tree-encoding"])
+	if !ok {
+		return nil, nil
+	}
+	content := te.decode(b)
+	if !re.MatchString(content) {
+		return nil, nil
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	fm := &FileMatch{Path: f.Name}
+
+	// The last line of the current group, so that overlapping context
+	// joins groups together.
+	last := -1
+	for i, l := range lines {
+		if limit > 0 && fm.Matches >= limit {
+			break
+		}
+		if i%1024 == 0 && ctx.Err() != nil {
+			break
+		}
+		locs := re.FindAllStringIndex(l, -1)
+		if locs == nil {
+			continue
+		}
+		fm.Matches++
+
+		from := max(i-opts.Context, 0)
+		if last < 0 || from > last+1 {
+			fm.Groups = append(fm.Groups, nil)
+		} else {
+			from = last + 1
+		}
+		g := &fm.Groups[len(fm.Groups)-1]
+
+		for j := from; j < i; j++ {
+			*g = append(*g, contextLine(j, lines[j]))
+		}
+		*g = append(*g, matchLine(i, l, locs))
+		last = i
+
+		// Context after the match; a later match in it takes over.
+		for j := i + 1; j <= min(i+opts.Context, len(lines)-1); j++ {
+			if re.MatchString(lines[j]) {
+				break
+			}
+			*g = append(*g, contextLine(j, lines[j]))
+			last = j
+		}
+	}
+
+	if fm.Matches == 0 {
+		return nil, nil
+	}
+	return fm, nil
+}
+
+func contextLine(i int, l string) SearchLine {
+	return SearchLine{N: i + 1, Parts: []SearchPart{{Text: l}}}
+}
+
+func matchLine(i int, l string, locs [][]int) SearchLine {
+	sl := SearchLine{N: i + 1, Match: true}
+	prev := 0
+	for _, loc := range locs {
+		if loc[0] > prev {
+			sl.Parts = append(sl.Parts, SearchPart{Text: l[prev:loc[0]]})
+		}
+		if loc[1] > loc[0] {
+			sl.Parts = append(sl.Parts, SearchPart{Text: l[loc[0]:loc[1]], Match: true})
+		}
+		prev = loc[1]
+	}
+	if prev < len(l) {
+		sl.Parts = append(sl.Parts, SearchPart{Text: l[prev:]})
+	}
+	return sl
+}
@@ -0,0 +1,88 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Submodule is a gitlink entry in a tree, along with what .gitmodules
+// says about it.
+type Submodule struct {
+	Name string
+	Path string
+	URL  string
+	// Commit is the submodule commit pinned by the superproject.
+	Commit string
+}
+
+// Submodule returns the submodule at path, or nil if there isn't one.
+func (g *GitRepo) Submodule(path string) (*Submodule, error) {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return nil, fmt.Errorf("commit object: %w", err)
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("file tree: %w", err)
+	}
+
+	e, err := tree.FindEntry(path)
+	if err != nil || e.Mode != filemode.Submodule {
+		return nil, nil
+	}
+
+	modules, err := readModules(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSubmodule(modules, path, e), nil
+}
+
+// readModules parses .gitmodules at the root of tree, keyed by path. A
+// missing .gitmodules isn't an error; there are just no submodules.
+func readModules(tree *object.Tree) (map[string]*config.Submodule, error) {
+	modules := map[string]*config.Submodule{}
+
+	f, err := tree.File(".gitmodules")
+	if err != nil {
+		return modules, nil
+	}
+
+	content, err := f.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("reading .gitmodules: %w", err)
+	}
+
+	m := config.NewModules()
+	if err := m.Unmarshal([]byte(content)); err != nil {
+		return nil, fmt.Errorf("parsing .gitmodules: %w", err)
+	}
+
+	for _, s := range m.Submodules {
+		modules[s.Path] = s
+	}
+
+	return modules, nil
+}
+
+func newSubmodule(modules map[string]*config.Submodule, path string, e *object.TreeEntry) *Submodule {
+	sm := &Submodule{
+		Name:   path,
+		Path:   path,
+		Commit: e.Hash.String(),
+	}
+
+	// A gitlink without a .gitmodules entry is still a submodule, we
+	// just don't know where it comes from.
+	if m, ok := modules[path]; ok {
+		sm.Name = m.Name
+		sm.URL = m.URL
+	}
+
+	return sm
+}
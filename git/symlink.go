@@ -0,0 +1,91 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// maxSymlinks is how many links ResolveSymlink follows before deciding
+// it's going in circles, same as Linux's MAXSYMLINKS.
+const maxSymlinks = 40
+
+var (
+	ErrSymlinkLoop    = errors.New("too many levels of symbolic links")
+	ErrSymlinkOutside = errors.New("symbolic link points outside the repository")
+)
+
+// ResolveSymlink follows symlinks in p, including ones in its leading
+// directories, and returns the path they lead to within the repository.
+// Paths without symlinks are returned unchanged.
+func (g *GitRepo) ResolveSymlink(p string) (string, error) {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return "", fmt.Errorf("commit object: %w", err)
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return "", fmt.Errorf("file tree: %w", err)
+	}
+
+	rest := strings.Split(path.Clean(p), "/")
+	resolved := ""
+	hops := 0
+
+	for len(rest) > 0 {
+		candidate := path.Join(resolved, rest[0])
+		rest = rest[1:]
+
+		e, err := tree.FindEntry(candidate)
+		if err != nil {
+			return "", err
+		}
+
+		if e.Mode != filemode.Symlink {
+			resolved = candidate
+			continue
+		}
+
+		hops++
+		if hops > maxSymlinks {
+			return "", ErrSymlinkLoop
+		}
+
+		target, err := symlinkTarget(tree, e)
+		if err != nil {
+			return "", err
+		}
+
+		if path.IsAbs(target) {
+			return "", ErrSymlinkOutside
+		}
+
+		// The target is relative to the link's directory; start
+		// over from there with whatever's left of the path.
+		next := path.Join(resolved, target)
+		if next == ".." || strings.HasPrefix(next, "../") {
+			return "", ErrSymlinkOutside
+		}
+
+		resolved = ""
+		if next != "." {
+			rest = append(strings.Split(next, "/"), rest...)
+		}
+	}
+
+	return resolved, nil
+}
+
+func symlinkTarget(t *object.Tree, e *object.TreeEntry) (string, error) {
+	f, err := t.TreeEntryFile(e)
+	if err != nil {
+		return "", err
+	}
+
+	return f.Contents()
+}
@@ -2,11 +2,19 @@ package git
 
 import (
 	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
 
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-func (g *GitRepo) FileTree(path string) ([]NiceTree, error) {
+// FileTree lists the entries of the directory at path. With lastCommits
+// set, each entry also gets the last commit that touched it.
+func (g *GitRepo) FileTree(path string, lastCommits bool) ([]NiceTree, error) {
 	c, err := g.r.CommitObject(g.h)
 	if err != nil {
 		return nil, fmt.Errorf("commit object: %w", err)
@@ -18,49 +26,160 @@ func (g *GitRepo) FileTree(path string) ([]NiceTree, error) {
 		return nil, fmt.Errorf("file tree: %w", err)
 	}
 
-	if path == "" {
-		files = makeNiceTree(tree)
-	} else {
+	modules, err := readModules(tree)
+	if err != nil {
+		// Non-fatal, submodules just won't have a URL.
+		log.Println(err)
+	}
+
+	if path != "" {
 		o, err := tree.FindEntry(path)
 		if err != nil {
 			return nil, err
 		}
+		if o.Mode.IsFile() {
+			return files, nil
+		}
 
-		if !o.Mode.IsFile() {
-			subtree, err := tree.Tree(path)
-			if err != nil {
-				return nil, err
-			}
+		tree, err = tree.Tree(path)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			files = makeNiceTree(subtree)
+	files = makeNiceTree(tree, path, modules)
+	sortTree(files)
+
+	if lastCommits {
+		lcs, err := g.lastCommits(path, tree)
+		if err != nil {
+			// Non-fatal, the columns just stay empty.
+			log.Println(err)
+		}
+		for i := range files {
+			files[i].LastCommit = lcs[files[i].Name]
 		}
 	}
 
 	return files, nil
 }
 
+// IsDir reports whether path is a directory.
+func (g *GitRepo) IsDir(path string) bool {
+	c, err := g.r.CommitObject(g.h)
+	if err != nil {
+		return false
+	}
+
+	t, err := dirTree(c, path)
+	return err == nil && t != nil
+}
+
 // A nicer git tree representation.
 type NiceTree struct {
-	Name      string
-	Mode      string
-	Size      int64
-	IsFile    bool
-	IsSubtree bool
+	Name        string
+	Mode        string
+	Size        int64
+	IsFile      bool
+	IsSubtree   bool
+	IsSubmodule bool
+	Submodule   *Submodule
+	IsSymlink   bool
+	// Target is where a symlink points, as written in the link.
+	Target string
+	// LastCommit is only set if FileTree was asked for it.
+	LastCommit *LastCommit
 }
 
-func makeNiceTree(t *object.Tree) []NiceTree {
+func makeNiceTree(t *object.Tree, parent string, modules map[string]*config.Submodule) []NiceTree {
 	nts := []NiceTree{}
 
 	for _, e := range t.Entries {
 		mode, _ := e.Mode.ToOSFileMode()
 		sz, _ := t.Size(e.Name)
-		nts = append(nts, NiceTree{
+		nt := NiceTree{
 			Name:   e.Name,
 			Mode:   mode.String(),
 			IsFile: e.Mode.IsFile(),
 			Size:   sz,
-		})
+		}
+
+		switch e.Mode {
+		case filemode.Submodule:
+			nt.IsSubmodule = true
+			nt.Submodule = newSubmodule(modules, path.Join(parent, e.Name), &e)
+		case filemode.Symlink:
+			nt.IsSymlink = true
+			nt.Target, _ = symlinkTarget(t, &e)
+		}
+
+		nts = append(nts, nt)
 	}
 
 	return nts
 }
+
+// sortTree puts directories and submodules before files, each in natural
+// order, so file2 sorts before file10.
+func sortTree(nts []NiceTree) {
+	sort.SliceStable(nts, func(i, j int) bool {
+		if nts[i].IsFile != nts[j].IsFile {
+			return !nts[i].IsFile
+		}
+		return naturalLess(nts[i].Name, nts[j].Name)
+	})
+}
+
+// naturalLess compares a and b, treating runs of digits as numbers and
+// ASCII letters case-insensitively; ties are broken byte-wise.
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			ni, nj := i, j
+			for ni < len(a) && isDigit(a[ni]) {
+				ni++
+			}
+			for nj < len(b) && isDigit(b[nj]) {
+				nj++
+			}
+
+			// Compare by value without parsing, so arbitrarily long
+			// runs work: drop leading zeros, then the longer run is
+			// bigger, then compare digit by digit.
+			da := strings.TrimLeft(a[i:ni], "0")
+			db := strings.TrimLeft(b[j:nj], "0")
+			if len(da) != len(db) {
+				return len(da) < len(db)
+			}
+			if da != db {
+				return da < db
+			}
+			i, j = ni, nj
+			continue
+		}
+
+		ca, cb := toLower(a[i]), toLower(b[j])
+		if ca != cb {
+			return ca < cb
+		}
+		i++
+		j++
+	}
+
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// Directories that hold third-party code, matched anywhere in a path.
+var vendorDirs = []string{
+	"vendor",
+	"third_party",
+	"node_modules",
+	"bower_components",
+	"Godeps",
+}
+
+// Files that are generated by tooling, matched against the base name.
+var generatedFiles = []string{
+	"go.sum",
+	"package-lock.json",
+	"yarn.lock",
+	"pnpm-lock.yaml",
+	"Cargo.lock",
+	"Gemfile.lock",
+	"poetry.lock",
+	"composer.lock",
+	"flake.lock",
+	"*.min.js",
+	"*.min.css",
+	"*.pb.go",
+	"*_pb2.py",
+	"*.map",
+}
+
+// isVendored reports whether p looks like third-party code checked into
+// the repository.
+func isVendored(p string) bool {
+	for _, dir := range strings.Split(path.Dir(p), "/") {
+		for _, v := range vendorDirs {
+			if dir == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isGenerated reports whether p looks like a generated file, either by its
+// name or by a "generated" marker in head, the first lines of its content.
+func isGenerated(p string, head []string) bool {
+	if isGeneratedName(p) {
+		return true
+	}
+	return slices.ContainsFunc(head, isGeneratedMarker)
+}
+
+// isGeneratedName reports whether p is named like a generated file.
+func isGeneratedName(p string) bool {
+	base := path.Base(p)
+	for _, pat := range generatedFiles {
+		if ok, _ := path.Match(pat, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isGeneratedMarker matches the conventional `// Code generated ... DO
+// NOT EDIT.` header, and the @generated tag used by other toolchains.
+func isGeneratedMarker(line string) bool {
+	return strings.Contains(line, "@generated") ||
+		(strings.Contains(line, "Code generated") && strings.Contains(line, "DO NOT EDIT"))
+}
@@ -0,0 +1,359 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"git.icyphox.sh/legit/cache"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+// SignatureStatus is the outcome of checking a commit or tag signature.
+// The zero value means the object isn't signed at all.
+type SignatureStatus string
+
+const (
+	SignatureVerified   SignatureStatus = "verified"
+	SignatureUnverified SignatureStatus = "unverified"
+	SignatureUnknownKey SignatureStatus = "unknown-key"
+)
+
+// Verification describes a signature on a commit or tag.
+type Verification struct {
+	Status SignatureStatus
+	// Format is either "pgp" or "ssh".
+	Format string
+	// Signer is the identity the key belongs to; only set once the
+	// signature has been verified.
+	Signer string
+	// KeyID identifies the signing key: a PGP key ID or an SSH key
+	// fingerprint.
+	KeyID string
+}
+
+// Keyring holds the keys trusted to sign commits and tags. A nil Keyring
+// trusts nobody, so every signature checked against it comes out as an
+// unknown key.
+type Keyring struct {
+	// pgp holds each file of armored keys as read, which is how go-git's
+	// Verify takes them.
+	pgp     []string
+	signers []allowedSigner
+	// verified holds outcomes by commit or tag hash; a signed object
+	// never changes, and neither do the keys while we're running.
+	verified *cache.LRU[plumbing.Hash, Verification]
+}
+
+// allowedSigner is one entry of an ssh-keygen(1) allowed_signers file.
+type allowedSigner struct {
+	principals string
+	key        ssh.PublicKey
+	namespaces []string
+}
+
+const (
+	sshSigMagic     = "SSHSIG"
+	sshSigNamespace = "git"
+	sshSigArmorHead = "-----BEGIN SSH SIGNATURE-----"
+	sshSigArmorTail = "-----END SSH SIGNATURE-----"
+	pgpSigArmorHead = "-----BEGIN PGP SIGNATURE-----"
+)
+
+// ReadKeyring loads armored OpenPGP public keys from pgpFiles and SSH keys
+// from an allowed_signers file; either may be empty. Files that can't be
+// read or parsed are logged and left out, rather than costing us the rest.
+func ReadKeyring(pgpFiles []string, allowedSigners string) *Keyring {
+	k := &Keyring{verified: cache.New[plumbing.Hash, Verification](4096)}
+
+	for _, f := range pgpFiles {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			log.Printf("reading pgp keys: %s", err)
+			continue
+		}
+		if _, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b)); err != nil {
+			log.Printf("parsing pgp keys in %s: %s", f, err)
+			continue
+		}
+		k.pgp = append(k.pgp, string(b))
+	}
+
+	if allowedSigners != "" {
+		b, err := os.ReadFile(allowedSigners)
+		if err != nil {
+			log.Printf("reading allowed signers: %s", err)
+			return k
+		}
+		k.signers, err = parseAllowedSigners(b)
+		if err != nil {
+			log.Printf("parsing allowed signers in %s: %s", allowedSigners, err)
+		}
+	}
+
+	return k
+}
+
+func parseAllowedSigners(b []byte) ([]allowedSigner, error) {
+	signers := []allowedSigner{}
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		principals, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing key", n)
+		}
+
+		// What follows the principals is in authorized_keys format,
+		// options and all.
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		signer := allowedSigner{principals: principals, key: key}
+		for _, o := range options {
+			if v, ok := strings.CutPrefix(o, "namespaces="); ok {
+				signer.namespaces = strings.Split(strings.Trim(v, `"`), ",")
+			}
+		}
+		signers = append(signers, signer)
+	}
+
+	return signers, s.Err()
+}
+
+// VerifyCommit checks the signature on c, if any.
+func (k *Keyring) VerifyCommit(c *object.Commit) Verification {
+	if c.PGPSignature == "" {
+		return Verification{}
+	}
+
+	return k.cached(c.Hash, func() Verification {
+		if strings.HasPrefix(c.PGPSignature, pgpSigArmorHead) {
+			return k.verifyPGP(c.PGPSignature, c.Verify)
+		}
+
+		encoded := &plumbing.MemoryObject{}
+		if err := c.EncodeWithoutSignature(encoded); err != nil {
+			return Verification{Status: SignatureUnverified}
+		}
+		return k.verify(encoded, c.PGPSignature)
+	})
+}
+
+// VerifyTag checks the signature on an annotated tag, if any. Lightweight
+// tags can't be signed.
+func (k *Keyring) VerifyTag(t *TagReference) Verification {
+	if t.tag == nil || t.tag.PGPSignature == "" {
+		return Verification{}
+	}
+
+	return k.cached(t.tag.Hash, func() Verification {
+		if strings.HasPrefix(t.tag.PGPSignature, pgpSigArmorHead) {
+			return k.verifyPGP(t.tag.PGPSignature, t.tag.Verify)
+		}
+
+		encoded := &plumbing.MemoryObject{}
+		if err := t.tag.EncodeWithoutSignature(encoded); err != nil {
+			return Verification{Status: SignatureUnverified}
+		}
+		return k.verify(encoded, t.tag.PGPSignature)
+	})
+}
+
+// cached returns the outcome of verifying the object h, working it out
+// with verify the first time.
+func (k *Keyring) cached(h plumbing.Hash, verify func() Verification) Verification {
+	if k == nil {
+		return verify()
+	}
+
+	if v, ok := k.verified.Get(h); ok {
+		return v
+	}
+	v := verify()
+	k.verified.Add(h, v)
+	return v
+}
+
+// verify checks an SSH signature over o.
+func (k *Keyring) verify(o plumbing.EncodedObject, sig string) Verification {
+	if !strings.HasPrefix(sig, sshSigArmorHead) {
+		// Most likely X.509, which we don't support.
+		return Verification{Status: SignatureUnknownKey}
+	}
+
+	r, err := o.Reader()
+	if err != nil {
+		return Verification{Status: SignatureUnverified}
+	}
+	defer r.Close()
+
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return Verification{Status: SignatureUnverified}
+	}
+
+	return k.verifySSH(payload, sig)
+}
+
+// verifyPGP checks sig with check, which is the signed object's Verify,
+// against each of our key files in turn.
+func (k *Keyring) verifyPGP(sig string, check func(armoredKeyRing string) (*openpgp.Entity, error)) Verification {
+	v := Verification{Format: "pgp", KeyID: pgpKeyID(sig), Status: SignatureUnknownKey}
+	if k == nil {
+		return v
+	}
+
+	for _, keys := range k.pgp {
+		entity, err := check(keys)
+		switch {
+		case errors.Is(err, pgperrors.ErrUnknownIssuer):
+			continue
+		case err != nil:
+			// One of our keys made it, but it doesn't check out.
+			v.Status = SignatureUnverified
+			return v
+		}
+
+		v.Status = SignatureVerified
+		if id := entity.PrimaryIdentity(); id != nil {
+			v.Signer = id.Name
+		}
+		return v
+	}
+
+	return v
+}
+
+// pgpKeyID digs the issuer key ID out of an armored signature, so unknown
+// keys can at least be named.
+func pgpKeyID(sig string) string {
+	block, err := armor.Decode(strings.NewReader(sig))
+	if err != nil {
+		return ""
+	}
+
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return ""
+	}
+
+	if s, ok := p.(*packet.Signature); ok && s.IssuerKeyId != nil {
+		return fmt.Sprintf("%016X", *s.IssuerKeyId)
+	}
+	return ""
+}
+
+// sshSig is the blob inside an armored SSH signature, as described in
+// OpenSSH's PROTOCOL.sshsig, minus the leading magic.
+type sshSig struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is what the signature in an sshSig actually covers.
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func (k *Keyring) verifySSH(payload []byte, armored string) Verification {
+	v := Verification{Format: "ssh", Status: SignatureUnverified}
+
+	body := strings.TrimSpace(armored)
+	body = strings.TrimPrefix(body, sshSigArmorHead)
+	body = strings.TrimSuffix(body, sshSigArmorTail)
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil || !bytes.HasPrefix(blob, []byte(sshSigMagic)) {
+		return v
+	}
+
+	var sig sshSig
+	if err := ssh.Unmarshal(blob[len(sshSigMagic):], &sig); err != nil {
+		return v
+	}
+	if sig.Version != 1 || sig.Namespace != sshSigNamespace {
+		return v
+	}
+
+	pub, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return v
+	}
+	v.KeyID = ssh.FingerprintSHA256(pub)
+
+	var hash []byte
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h := sha256.Sum256(payload)
+		hash = h[:]
+	case "sha512":
+		h := sha512.Sum512(payload)
+		hash = h[:]
+	default:
+		return v
+	}
+
+	signed := append([]byte(sshSigMagic), ssh.Marshal(sshSignedData{
+		Namespace:     sig.Namespace,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          hash,
+	})...)
+
+	s := &ssh.Signature{}
+	if err := ssh.Unmarshal(sig.Signature, s); err != nil {
+		return v
+	}
+	if err := pub.Verify(signed, s); err != nil {
+		return v
+	}
+
+	// The signature is good; whether we trust it is up to the allowed
+	// signers.
+	v.Status = SignatureUnknownKey
+	if k == nil {
+		return v
+	}
+
+	for _, as := range k.signers {
+		if !bytes.Equal(as.key.Marshal(), pub.Marshal()) {
+			continue
+		}
+		if as.namespaces != nil && !slices.Contains(as.namespaces, sshSigNamespace) {
+			continue
+		}
+		v.Status = SignatureVerified
+		v.Signer = as.principals
+		break
+	}
+
+	return v
+}
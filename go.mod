@@ -3,20 +3,25 @@ module git.icyphox.sh/legit
 go 1.22.0
 
 require (
+	github.com/ProtonMail/go-crypto v1.1.5
 	github.com/alecthomas/chroma/v2 v2.14.0
 	github.com/bluekeyes/go-gitdiff v0.8.0
 	github.com/cyphar/filepath-securejoin v0.4.1
 	github.com/dustin/go-humanize v1.0.1
 	github.com/go-git/go-git/v5 v5.13.2
 	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/niklasfasching/go-org v1.8.0
 	github.com/russross/blackfriday/v2 v2.1.0
+	github.com/sergi/go-diff v1.3.1
+	golang.org/x/crypto v0.33.0
+	golang.org/x/net v0.35.0
 	golang.org/x/sys v0.30.0
+	golang.org/x/text v0.22.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/Microsoft/go-winio v0.6.2 // indirect
-	github.com/ProtonMail/go-crypto v1.1.5 // indirect
 	github.com/acomagu/bufpipe v1.0.4 // indirect
 	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/cloudflare/circl v1.6.0 // indirect
@@ -29,11 +34,8 @@ require (
 	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99 // indirect
 	github.com/kevinburke/ssh_config v1.2.0 // indirect
 	github.com/pjbgf/sha1cd v0.3.2 // indirect
-	github.com/sergi/go-diff v1.3.1 // indirect
 	github.com/skeema/knownhosts v1.3.1 // indirect
 	github.com/xanzy/ssh-agent v0.3.3 // indirect
-	golang.org/x/crypto v0.33.0 // indirect
-	golang.org/x/net v0.35.0 // indirect
 	gopkg.in/warnings.v0 v0.1.2 // indirect
 )
 
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/exec"
 
 	"git.icyphox.sh/legit/config"
 	"git.icyphox.sh/legit/routes"
@@ -20,12 +22,62 @@ func main() {
 		log.Fatal(err)
 	}
 
-	if err := UnveilPaths([]string{
+	paths := []string{
 		c.Dirs.Static,
 		c.Repo.ScanPath,
 		c.Dirs.Templates,
-	},
-		"r"); err != nil {
+	}
+	paths = append(paths, c.Keys.PGP...)
+	if c.Keys.AllowedSigners != "" {
+		paths = append(paths, c.Keys.AllowedSigners)
+	}
+
+	// Filters are run, not just read.
+	filters := [][]string{c.Filters.Commit}
+	for _, f := range c.Filters.Files {
+		filters = append(filters, f.Command)
+	}
+	var runsFilters bool
+	for _, f := range filters {
+		if len(f) == 0 {
+			continue
+		}
+		bin, err := exec.LookPath(f[0])
+		if err != nil {
+			log.Fatalf("filter: %s", err)
+		}
+		if err := Unveil(bin, "rx"); err != nil {
+			log.Fatalf("unveil: %s", err)
+		}
+		runsFilters = true
+	}
+
+	// Most filters are dynamically linked, or scripts that run other
+	// programs, so they need the system's binaries, the runtime linker
+	// and its libraries too, and those of packages.
+	if runsFilters {
+		for _, p := range []string{"/bin", "/usr/bin", "/usr/local/bin", "/usr/libexec/ld.so"} {
+			if err := Unveil(p, "rx"); err != nil {
+				log.Fatalf("unveil: %s", err)
+			}
+		}
+		if err := UnveilPaths([]string{"/usr/lib", "/usr/local/lib"}, "r"); err != nil {
+			log.Fatalf("unveil: %s", err)
+		}
+	}
+
+	// The search index is written to, so it has to exist before it can
+	// be unveiled.
+	if c.Search.Index != "" {
+		if err := os.MkdirAll(c.Search.Index, 0o755); err != nil {
+			log.Fatalf("search index: %s", err)
+		}
+		if err := Unveil(c.Search.Index, "rwc"); err != nil {
+			log.Fatalf("unveil: %s", err)
+		}
+	}
+
+	if err := UnveilPaths(paths, "r"); err != nil {
 		log.Fatalf("unveil: %s", err)
 	}
 
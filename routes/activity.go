@@ -0,0 +1,170 @@
+package routes
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+
+	"git.icyphox.sh/legit/git"
+)
+
+const (
+	// heatmapWeeks is how far back the heatmap goes: a year, and the
+	// week in progress.
+	heatmapWeeks = 53
+	// sparklineWeeks is how far back the index's sparklines go.
+	sparklineWeeks = 26
+
+	cell     = 10
+	cellStep = 12
+)
+
+// weekStart returns midnight on the Sunday of t's week.
+func weekStart(t time.Time) time.Time {
+	d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return d.AddDate(0, 0, -int(d.Weekday()))
+}
+
+// plural formats n commits.
+func plural(n int) string {
+	if n == 1 {
+		return "1 commit"
+	}
+	return fmt.Sprintf("%d commits", n)
+}
+
+// level buckets n out of max into 0 to 4, for shading.
+func level(n, max int) int {
+	if n == 0 || max == 0 {
+		return 0
+	}
+	return (n*4 + max - 1) / max
+}
+
+// heatmapSVG draws a calendar of commits per day for the year up to now,
+// a column per week.
+func heatmapSVG(a *git.Activity, now time.Time) template.HTML {
+	const left, top = 28, 16
+	start := weekStart(now).AddDate(0, 0, -7*(heatmapWeeks-1))
+
+	max := 0
+	for d := start; !d.After(now); d = d.AddDate(0, 0, 1) {
+		if n := a.Day(d); n > max {
+			max = n
+		}
+	}
+
+	width, height := left+heatmapWeeks*cellStep, top+7*cellStep
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="heatmap" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="commits per day">`,
+		width, height, width, height)
+
+	for i, day := range []string{"Mon", "Wed", "Fri"} {
+		fmt.Fprintf(&b, `<text x="0" y="%d">%s</text>`, top+(2*i+1)*cellStep+cell-1, day)
+	}
+
+	month := time.Month(0)
+	for w := 0; w < heatmapWeeks; w++ {
+		week := start.AddDate(0, 0, 7*w)
+		// Label each month over its first week, unless the label
+		// would run into the next one or off the end.
+		if week.Month() != month {
+			month = week.Month()
+			crowded := w == 0 && week.AddDate(0, 0, 14).Month() != month
+			if !crowded && w < heatmapWeeks-2 {
+				fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, left+w*cellStep, top-5, month.String()[:3])
+			}
+		}
+
+		for d := 0; d < 7; d++ {
+			day := week.AddDate(0, 0, d)
+			if day.After(now) {
+				break
+			}
+			n := a.Day(day)
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="2" class="level-%d"><title>%s on %s</title></rect>`,
+				left+w*cellStep, top+d*cellStep, cell, cell, level(n, max),
+				plural(n), day.Format("Jan 2, 2006"))
+		}
+	}
+
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// punchCardSVG draws commits by weekday and hour, as circles sized by
+// count.
+func punchCardSVG(a *git.Activity) template.HTML {
+	const left, bottom, step = 32, 16, 20
+
+	max := 0
+	for _, hours := range a.Hours {
+		for _, n := range hours {
+			if n > max {
+				max = n
+			}
+		}
+	}
+
+	width, height := left+24*step, 7*step+bottom
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="punchcard" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="commits by hour">`,
+		width, height, width, height)
+
+	for d, hours := range a.Hours {
+		y := d*step + step/2
+		fmt.Fprintf(&b, `<text x="0" y="%d">%s</text>`, y+4, time.Weekday(d).String()[:3])
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d"/>`, left, y, width, y)
+
+		for h, n := range hours {
+			if n == 0 {
+				continue
+			}
+			// Area, not radius, goes with the count.
+			r := math.Sqrt(float64(n)/float64(max)) * (step/2 - 1)
+			fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%.1f"><title>%s on %ss at %02d:00</title></circle>`,
+				left+h*step+step/2, y, math.Max(r, 1.5), plural(n), time.Weekday(d), h)
+		}
+	}
+
+	for h := 0; h < 24; h += 3 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">%02d</text>`, left+h*step+step/2, height-2, h)
+	}
+
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// sparklineSVG draws commits per week for the last few months as a line.
+func sparklineSVG(a *git.Activity, now time.Time) template.HTML {
+	const step, height = 4, 16
+	start := weekStart(now).AddDate(0, 0, -7*(sparklineWeeks-1))
+
+	weeks := make([]int, sparklineWeeks)
+	max, total := 0, 0
+	for w := range weeks {
+		for d := 0; d < 7; d++ {
+			weeks[w] += a.Day(start.AddDate(0, 0, 7*w+d))
+		}
+		if weeks[w] > max {
+			max = weeks[w]
+		}
+		total += weeks[w]
+	}
+
+	points := make([]string, len(weeks))
+	for w, n := range weeks {
+		y := height - 1.0
+		if max > 0 {
+			y -= float64(n) / float64(max) * (height - 2)
+		}
+		points[w] = fmt.Sprintf("%d,%.1f", w*step, y)
+	}
+
+	width := (sparklineWeeks - 1) * step
+	return template.HTML(fmt.Sprintf(
+		`<svg class="sparkline" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="commits per week"><title>%s in the last %d weeks</title><polyline points="%s"/></svg>`,
+		width, height, width, height, plural(total), sparklineWeeks, strings.Join(points, " ")))
+}
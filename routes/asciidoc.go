@@ -0,0 +1,417 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A subset of AsciiDoc: titles, paragraphs, nested lists, delimited
+// blocks, admonitions, images, simple tables, attribute references and the
+// common inline markup. Anything else comes out as plain text.
+
+var (
+	adocTitle      = regexp.MustCompile(`^(={1,6}|#{1,6}) +(.+)$`)
+	adocAttribute  = regexp.MustCompile(`^:([\w-]+): *(.*)$`)
+	adocAttrRef    = regexp.MustCompile(`\{([\w-]+)\}`)
+	adocListItem   = regexp.MustCompile(`^ *(\*{1,5}|-|\.{1,5}|\d+\.) +(.*)$`)
+	adocAdmonition = regexp.MustCompile(`^(NOTE|TIP|IMPORTANT|WARNING|CAUTION): +(.*)$`)
+	adocImage      = regexp.MustCompile(`^image::([^\[]+)\[([^\]]*)\]$`)
+	adocBlockTitle = regexp.MustCompile(`^\.([^\s.].*)$`)
+	adocInline     = regexp.MustCompile("`([^`]+)`" +
+		`|(?:^|(\W))\*([^*\s](?:[^*]*[^*\s])?)\*` +
+		`|(?:^|(\W))_([^_\s](?:[^_]*[^_\s])?)_` +
+		`|image:([^\s\[:][^\s\[]*)\[([^\]]*)\]` +
+		`|(?:link|xref):([^\s\[]+)\[([^\]]*)\]` +
+		`|(https?://[^\s\[<]+)\[([^\]]*)\]` +
+		`|<<([^,>]+)(?:, *([^>]+))?>>` +
+		`|(https?://[^\s<>\[]*[^\s<>\[.,;:!?)'"])`)
+)
+
+// adocDelimiters are the lines that open and close delimited blocks, with
+// what each holds.
+var adocDelimiters = map[string]string{
+	"----": "listing",
+	"....": "literal",
+	"++++": "pass",
+	"____": "quote",
+	"====": "example",
+	"****": "sidebar",
+	"////": "comment",
+	"--":   "open",
+	"|===": "table",
+}
+
+// Caps on attribute expansion. Values built from other attributes can
+// double in size with every definition, so past these references are
+// left as they are.
+const (
+	// maxAttrValue is the longest an expanded attribute may be.
+	maxAttrValue = 4 << 10
+	// maxAttrTotal is how much expansion a whole document gets.
+	maxAttrTotal = 1 << 20
+)
+
+type asciidocWriter struct {
+	bytes.Buffer
+	ids   headingIDs
+	attrs map[string]string
+	// expanded counts the bytes substituted for references so far.
+	expanded int
+	// depth is how many blocks deep the writer is.
+	depth int
+}
+
+func asciidocHTML(content string) ([]byte, error) {
+	w := &asciidocWriter{ids: headingIDs{}, attrs: map[string]string{}}
+	w.blocks(lightLines(content))
+	return w.Bytes(), nil
+}
+
+// delimiter returns the kind of delimited block l opens, if any. Longer
+// runs of the same character work too.
+func delimiter(l string) string {
+	if kind, ok := adocDelimiters[l]; ok {
+		return kind
+	}
+	if len(l) > 4 && strings.Count(l, l[:1]) == len(l) {
+		return adocDelimiters[l[:4]]
+	}
+	return ""
+}
+
+func (w *asciidocWriter) blocks(lines []string) {
+	w.depth++
+	defer func() { w.depth-- }()
+	if w.depth > maxNesting {
+		writePre(w, lines)
+		return
+	}
+
+	// The attribute list and title for the next block, as in [source,go]
+	// and .Title.
+	var attrs, title string
+
+	for i := 0; i < len(lines); {
+		l := lines[i]
+
+		switch {
+		case l == "" || l == "+":
+			i++
+			continue
+
+		case strings.HasPrefix(l, "//") && delimiter(l) != "comment":
+			i++
+			continue
+
+		case adocAttribute.MatchString(l):
+			// References in the value are expanded here, once, so
+			// attributes can't refer to themselves.
+			m := adocAttribute.FindStringSubmatch(l)
+			v := w.substitute(m[2])
+			if len(v) > maxAttrValue {
+				v = m[2]
+			}
+			w.attrs[m[1]] = v
+			i++
+			continue
+
+		case strings.HasPrefix(l, "[") && strings.HasSuffix(l, "]"):
+			attrs = strings.Trim(l, "[]")
+			i++
+			continue
+
+		case adocBlockTitle.MatchString(l):
+			title = l[1:]
+			i++
+			continue
+		}
+
+		if title != "" {
+			fmt.Fprintf(w, "<p><strong>%s</strong></p>\n", w.inline(title))
+		}
+
+		switch {
+		case delimiter(l) != "":
+			i = w.delimited(lines, i, attrs)
+
+		case adocTitle.MatchString(l):
+			m := adocTitle.FindStringSubmatch(l)
+			text := w.substitute(m[2])
+			writeHeading(w, w.ids, len(m[1]), text, w.markup(text, 0))
+			i++
+
+		case l == "'''" || l == "---" || l == "***":
+			w.WriteString("<hr>\n")
+			i++
+
+		case l == "<<<":
+			i++
+
+		case adocImage.MatchString(l):
+			m := adocImage.FindStringSubmatch(l)
+			fmt.Fprintf(w, `<p><img src="%s" alt="%s"></p>`+"\n",
+				html.EscapeString(m[1]), html.EscapeString(imageAlt(m[2])))
+			i++
+
+		case adocListItem.MatchString(l):
+			i = w.list(lines, i)
+
+		case indentOf(l) > 0:
+			// Literal paragraph.
+			start := i
+			for i < len(lines) && lines[i] != "" {
+				i++
+			}
+			writePre(w, dedent(lines[start:i], indentOf(l)))
+
+		default:
+			i = w.paragraph(lines, i, attrs)
+		}
+
+		attrs, title = "", ""
+	}
+}
+
+// adocAdmonitionStyles are the attribute lists that turn a block into an
+// admonition.
+var adocAdmonitionStyles = map[string]bool{
+	"NOTE": true, "TIP": true, "IMPORTANT": true, "WARNING": true, "CAUTION": true,
+}
+
+func (w *asciidocWriter) delimited(lines []string, i int, attrs string) int {
+	delim := lines[i]
+	kind := delimiter(delim)
+
+	start := i + 1
+	end := start
+	for end < len(lines) && lines[end] != delim {
+		end++
+	}
+	body := lines[start:end]
+
+	style, _, _ := strings.Cut(attrs, ",")
+	switch {
+	case kind == "comment":
+	case kind == "listing" || kind == "literal" || kind == "pass":
+		writePre(w, body)
+	case kind == "table":
+		w.table(body, strings.Contains(attrs, "header"))
+	case adocAdmonitionStyles[style]:
+		w.admonition(style, body)
+	case kind == "quote":
+		w.WriteString("<blockquote>\n")
+		w.blocks(body)
+		w.WriteString("</blockquote>\n")
+	default:
+		w.WriteString("<div>\n")
+		w.blocks(body)
+		w.WriteString("</div>\n")
+	}
+
+	return end + 1
+}
+
+func (w *asciidocWriter) admonition(kind string, body []string) {
+	fmt.Fprintf(w, "<div class=\"admonition\">\n<p><strong>%s</strong></p>\n", kind[:1]+strings.ToLower(kind[1:]))
+	w.blocks(body)
+	w.WriteString("</div>\n")
+}
+
+func (w *asciidocWriter) paragraph(lines []string, i int, attrs string) int {
+	var para []string
+	for ; i < len(lines) && lines[i] != ""; i++ {
+		if len(para) > 0 && (delimiter(lines[i]) != "" || adocListItem.MatchString(lines[i])) {
+			break
+		}
+		para = append(para, lines[i])
+	}
+	text := strings.Join(para, "\n")
+
+	if m := adocAdmonition.FindStringSubmatch(text); m != nil {
+		w.admonition(m[1], []string{m[2]})
+		return i
+	}
+	if adocAdmonitionStyles[attrs] {
+		w.admonition(attrs, para)
+		return i
+	}
+
+	fmt.Fprintf(w, "<p>%s</p>\n", w.inline(text))
+	return i
+}
+
+// list writes a run of list items, nesting them by their markers: each
+// marker not seen yet in the run opens a deeper list.
+func (w *asciidocWriter) list(lines []string, i int) int {
+	var open []string
+
+	for i < len(lines) {
+		m := adocListItem.FindStringSubmatch(lines[i])
+		if m == nil {
+			break
+		}
+		marker := m[1]
+		if marker[0] >= '0' && marker[0] <= '9' {
+			marker = "."
+		}
+
+		// Items can run on over several lines.
+		text := []string{m[2]}
+		for i++; i < len(lines) && lines[i] != "" && !adocListItem.MatchString(lines[i]) && delimiter(lines[i]) == ""; i++ {
+			text = append(text, strings.TrimSpace(lines[i]))
+		}
+
+		depth := -1
+		for d, o := range open {
+			if o == marker {
+				depth = d
+			}
+		}
+		if depth < 0 {
+			open = append(open, marker)
+			fmt.Fprintf(w, "<%s>\n<li>", listTag(marker))
+		} else {
+			for len(open) > depth+1 {
+				fmt.Fprintf(w, "</li>\n</%s>\n", listTag(open[len(open)-1]))
+				open = open[:len(open)-1]
+			}
+			w.WriteString("</li>\n<li>")
+		}
+		w.WriteString(w.item(strings.Join(text, "\n")))
+
+		for i < len(lines) && lines[i] == "" && i+1 < len(lines) && adocListItem.MatchString(lines[i+1]) {
+			i++
+		}
+	}
+
+	for len(open) > 0 {
+		fmt.Fprintf(w, "</li>\n</%s>\n", listTag(open[len(open)-1]))
+		open = open[:len(open)-1]
+	}
+	return i
+}
+
+func listTag(marker string) string {
+	if marker[0] == '.' {
+		return "ol"
+	}
+	return "ul"
+}
+
+// item renders a list item's text, which might be a checklist item.
+func (w *asciidocWriter) item(text string) string {
+	for _, m := range []string{"[ ] ", "[x] ", "[*] "} {
+		if rest, ok := strings.CutPrefix(text, m); ok {
+			checked := ""
+			if m != "[ ] " {
+				checked = " checked"
+			}
+			return fmt.Sprintf(`<input type="checkbox" disabled%s> %s`, checked, w.inline(rest))
+		}
+	}
+	return w.inline(text)
+}
+
+func (w *asciidocWriter) table(body []string, header bool) {
+	var rows [][]string
+	var cells []string
+	cols := 0
+	for n, l := range body {
+		if l == "" {
+			// A blank line after the first row makes it the header.
+			if n == 1 && len(rows) == 1 {
+				header = true
+			}
+			continue
+		}
+		for _, c := range strings.Split(l, "|")[1:] {
+			cells = append(cells, strings.TrimSpace(c))
+		}
+		if cols == 0 {
+			cols = len(cells)
+		}
+		for cols > 0 && len(cells) >= cols {
+			rows = append(rows, cells[:cols])
+			cells = cells[cols:]
+		}
+	}
+
+	w.WriteString("<table>\n")
+	for n, row := range rows {
+		tag := "td"
+		if header && n == 0 {
+			tag = "th"
+		}
+		w.WriteString("<tr>")
+		for _, c := range row {
+			fmt.Fprintf(w, "<%s>%s</%[1]s>", tag, w.inline(c))
+		}
+		w.WriteString("</tr>\n")
+	}
+	w.WriteString("</table>\n")
+}
+
+// substitute replaces references to attributes that have been defined,
+// until the document has had maxAttrTotal bytes of them.
+func (w *asciidocWriter) substitute(text string) string {
+	return adocAttrRef.ReplaceAllStringFunc(text, func(ref string) string {
+		v, ok := w.attrs[ref[1:len(ref)-1]]
+		if !ok || w.expanded+len(v) > maxAttrTotal {
+			return ref
+		}
+		w.expanded += len(v)
+		return v
+	})
+}
+
+// inline renders the inline markup in text, after expanding attribute
+// references.
+func (w *asciidocWriter) inline(text string) string {
+	return w.markup(w.substitute(text), 0)
+}
+
+// markup renders inline markup, which nests in bold and italic text up to
+// maxNesting deep. Attributes have already been expanded.
+func (w *asciidocWriter) markup(text string, depth int) string {
+	if depth >= maxNesting {
+		return html.EscapeString(text)
+	}
+	return inlineHTML(text, adocInline, func(m []string) string {
+		switch {
+		case m[1] != "":
+			return "<code>" + html.EscapeString(m[1]) + "</code>"
+		case m[3] != "":
+			return html.EscapeString(m[2]) + "<strong>" + w.markup(m[3], depth+1) + "</strong>"
+		case m[5] != "":
+			return html.EscapeString(m[4]) + "<em>" + w.markup(m[5], depth+1) + "</em>"
+		case m[6] != "":
+			return fmt.Sprintf(`<img src="%s" alt="%s">`, html.EscapeString(m[6]), html.EscapeString(imageAlt(m[7])))
+		case m[8] != "":
+			return link(m[8], linkText(m[9], m[8]))
+		case m[10] != "":
+			return link(m[10], linkText(m[11], m[10]))
+		case m[12] != "":
+			return link("#"+m[12], linkText(m[13], m[12]))
+		default:
+			return link(m[14], html.EscapeString(m[14]))
+		}
+	})
+}
+
+// linkText is the escaped text for a link, falling back to its target.
+func linkText(text, target string) string {
+	if text == "" {
+		text = target
+	}
+	return html.EscapeString(text)
+}
+
+// imageAlt picks the alt text out of an image macro's attributes.
+func imageAlt(attrs string) string {
+	alt, _, _ := strings.Cut(attrs, ",")
+	return alt
+}
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAsciidocAttributeGrowth(t *testing.T) {
+	// Each definition doubles the last; expanded in full, the final
+	// reference would be 32MB.
+	in := ":a: xx\n" + strings.Repeat(":a: {a}{a}\n", 24) + "{a}\n"
+
+	out, err := asciidocHTML(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > 2*maxAttrValue {
+		t.Errorf("got %d bytes of output from %d bytes of input", len(out), len(in))
+	}
+
+	// Lots of references to a capped value stop at the document cap.
+	in = ":a: " + strings.Repeat("x", maxAttrValue) + "\n\n" + strings.Repeat("{a}", 1000) + "\n"
+	out, err = asciidocHTML(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > maxAttrTotal+len(in) {
+		t.Errorf("got %d bytes of output from %d bytes of input", len(out), len(in))
+	}
+}
+
+func TestAsciidocHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"self-referencing attribute",
+			":a: *{a}*\n\n{a}\n",
+			"<p><strong>{a}</strong></p>\n",
+		},
+		{
+			"attributes",
+			":name: World\n\nHello {name}, {missing}.\n",
+			"<p>Hello World, {missing}.</p>\n",
+		},
+		{
+			"attribute referring to another",
+			":a: one\n:b: {a} two\n\n{b}\n",
+			"<p>one two</p>\n",
+		},
+		{
+			"title and inline markup",
+			"= Title\n\nSome *bold* and _italic_ and `code`.\n",
+			`<h1><a id="title" class="anchor" href="#title">#</a>Title</h1>` + "\n" +
+				"<p>Some <strong>bold</strong> and <em>italic</em> and <code>code</code>.</p>\n",
+		},
+		{
+			"nested list",
+			"* one\n** two\n* three\n",
+			"<ul>\n<li>one<ul>\n<li>two</li>\n</ul>\n</li>\n<li>three</li>\n</ul>\n",
+		},
+		{
+			"ordered list",
+			". first\n. second\n",
+			"<ol>\n<li>first</li>\n<li>second</li>\n</ol>\n",
+		},
+		{
+			"checklist",
+			"* [x] done\n* [ ] todo\n",
+			"<ul>\n<li><input type=\"checkbox\" disabled checked> done</li>\n<li><input type=\"checkbox\" disabled> todo</li>\n</ul>\n",
+		},
+		{
+			"admonition",
+			"NOTE: Mind the gap.\n",
+			"<div class=\"admonition\">\n<p><strong>Note</strong></p>\n<p>Mind the gap.</p>\n</div>\n",
+		},
+		{
+			"listing block",
+			"[source,go]\n----\nfmt.Println(\"<hi>\")\n----\n",
+			"<pre><code>fmt.Println(&#34;&lt;hi&gt;&#34;)</code></pre>\n",
+		},
+		{
+			"table with header",
+			"|===\n| a | b\n\n| 1 | 2\n|===\n",
+			"<table>\n<tr><th>a</th><th>b</th></tr>\n<tr><td>1</td><td>2</td></tr>\n</table>\n",
+		},
+		{
+			"links",
+			"See https://example.com[the site] and <<intro,Intro>>.\n",
+			`<p>See <a href="https://example.com">the site</a> and <a href="#intro">Intro</a>.</p>` + "\n",
+		},
+		{
+			"image",
+			"image::pic.png[A picture]\n",
+			`<p><img src="pic.png" alt="A picture"></p>` + "\n",
+		},
+		{
+			"comment",
+			"// hidden\nshown\n",
+			"<p>shown</p>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := asciidocHTML(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("asciidocHTML(%q) =\n%s\nwant\n%s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsciidocNesting(t *testing.T) {
+	// Delimited blocks of growing length each open a new block.
+	var lines []string
+	for n := 4; n < 4+2*maxNesting; n++ {
+		lines = append(lines, strings.Repeat("=", n))
+	}
+	lines = append(lines, "deep")
+	if _, err := asciidocHTML(strings.Join(lines, "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "x"
+	for i := 0; i < 2*maxNesting; i++ {
+		text = "*_" + text + "_*"
+	}
+	got, err := asciidocHTML(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(got), "<strong>"); n > maxNesting {
+		t.Errorf("%d levels of <strong>, want at most %d", n, maxNesting)
+	}
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// fileFilter returns the configured filter command for the file at p, if
+// any. Patterns are matched against the whole path, then the base name.
+func (d *deps) fileFilter(p string) []string {
+	for _, f := range d.c.Filters.Files {
+		if len(f.Command) == 0 {
+			continue
+		}
+		if ok, _ := path.Match(f.Match, p); ok {
+			return f.Command
+		}
+		if ok, _ := path.Match(f.Match, path.Base(p)); ok {
+			return f.Command
+		}
+	}
+	return nil
+}
+
+// filterEnv is what filters get of legit's own environment; the rest,
+// like credentials, is none of their business.
+var filterEnv = []string{"PATH", "HOME", "LANG"}
+
+// runFilter pipes input through command and returns what it writes. env
+// is added to the filter's environment.
+func (d *deps) runFilter(command []string, input string, env ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.c.Filters.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(input)
+	for _, k := range filterEnv {
+		if v, ok := os.LookupEnv(k); ok {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	cmd.Env = append(cmd.Env, env...)
+	// Don't wait forever on anything the filter left running with our
+	// pipes open.
+	cmd.WaitDelay = time.Second
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %w: %s", command[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// renderFile renders the file at p in repo name as a document, through
+// its filter if there is one, otherwise with its markup renderer. It
+// returns false if neither works.
+func (d *deps) renderFile(name, ref, p, content string) (template.HTML, bool) {
+	base := &markupBase{name: name, ref: ref, dir: path.Dir(p)}
+
+	if command := d.fileFilter(p); command != nil {
+		out, err := d.runFilter(command, content,
+			"LEGIT_REPO="+name,
+			"LEGIT_REF="+ref,
+			"LEGIT_PATH="+p,
+		)
+		if err == nil {
+			return sanitizeFilter(out, base), true
+		}
+		log.Println(err)
+	}
+
+	return renderMarkup(p, content, base)
+}
+
+// isRenderable reports whether renderFile has a way to render the file
+// at p.
+func (d *deps) isRenderable(p string) bool {
+	return d.fileFilter(p) != nil || isMarkup(p)
+}
+
+// filterMessage runs a commit message through the commit filter. It
+// returns "" if there's no filter or it failed, so the plain message can
+// be shown instead.
+func (d *deps) filterMessage(name, hash, message string) template.HTML {
+	if len(d.c.Filters.Commit) == 0 {
+		return ""
+	}
+
+	out, err := d.runFilter(d.c.Filters.Commit, message,
+		"LEGIT_REPO="+name,
+		"LEGIT_COMMIT="+hash,
+	)
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+	return sanitizeFilter(out, nil)
+}
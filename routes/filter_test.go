@@ -0,0 +1,39 @@
+package routes
+
+import "testing"
+
+func TestSanitizeFilter(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"highlighter classes",
+			`<pre class="chroma"><code><span class="kd">func</span></code></pre>`,
+			`<pre class="chroma"><code><span class="kd">func</span></code></pre>`,
+		},
+		{
+			"classes elsewhere",
+			`<p class="x"><b class="y">hi</b></p>`,
+			`<p><b>hi</b></p>`,
+		},
+		{
+			"styles and scripts",
+			`<span style="color:red" onclick="x()">a</span><script>alert(1)</script>`,
+			`<span>a</span>`,
+		},
+		{
+			"odd class values",
+			`<span class="a&quot;b">a</span>`,
+			`<span>a</span>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(sanitizeFilter([]byte(tt.in), nil))
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
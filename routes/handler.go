@@ -1,9 +1,12 @@
 package routes
 
 import (
+	"log"
 	"net/http"
 
+	"git.icyphox.sh/legit/cache"
 	"git.icyphox.sh/legit/config"
+	"git.icyphox.sh/legit/git"
 )
 
 // Checks for gitprotocol-http(5) specific smells; if found, passes
@@ -30,18 +33,45 @@ func (d *deps) Multiplex(w http.ResponseWriter, r *http.Request) {
 
 func Handlers(c *config.Config) *http.ServeMux {
 	mux := http.NewServeMux()
-	d := deps{c}
+	d := deps{
+		c:      c,
+		sums:   cache.New[string, string](256),
+		ranges: cache.New[string, []releaseCommit](256),
+		warm:   make(chan func(), 64),
+	}
+	go d.warmLoop()
+
+	d.keys = git.ReadKeyring(c.Keys.PGP, c.Keys.AllowedSigners)
+
+	if c.Search.Index != "" {
+		ix, err := git.OpenIndex(c.Search.Index, c.Search.MaxFileBytes)
+		if err != nil {
+			log.Printf("search index: %s", err)
+		} else {
+			d.index = ix
+			go d.indexLoop()
+		}
+	}
 
 	mux.HandleFunc("GET /", d.Index)
 	mux.HandleFunc("GET /static/{file}", d.ServeStatic)
+	mux.HandleFunc("GET /search/{$}", d.SiteSearch)
 	mux.HandleFunc("GET /{name}", d.Multiplex)
 	mux.HandleFunc("POST /{name}", d.Multiplex)
 	mux.HandleFunc("GET /{name}/tree/{ref}/{rest...}", d.RepoTree)
 	mux.HandleFunc("GET /{name}/blob/{ref}/{rest...}", d.FileContent)
+	mux.HandleFunc("GET /{name}/raw/{ref}/{rest...}", d.Raw)
 	mux.HandleFunc("GET /{name}/log/{ref}", d.Log)
+	mux.HandleFunc("GET /{name}/search/{ref}", d.Search)
 	mux.HandleFunc("GET /{name}/archive/{file}", d.Archive)
 	mux.HandleFunc("GET /{name}/commit/{ref}", d.Diff)
+	mux.HandleFunc("GET /{name}/commit/{ref}/{rest...}", d.Diff)
+	mux.HandleFunc("GET /{name}/compare/{range}", d.Compare)
 	mux.HandleFunc("GET /{name}/refs/{$}", d.Refs)
+	mux.HandleFunc("GET /{name}/tag/{tag...}", d.Tag)
+	mux.HandleFunc("GET /{name}/releases/{$}", d.Releases)
+	mux.HandleFunc("GET /{name}/contributors/{$}", d.Contributors)
+	mux.HandleFunc("GET /{name}/activity/{$}", d.Activity)
 	mux.HandleFunc("GET /{name}/{rest...}", d.Multiplex)
 	mux.HandleFunc("POST /{name}/{rest...}", d.Multiplex)
 
@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// Roughly GitHub-flavoured: tables, autolinks and strikethrough come with
+// the common extensions, task lists are handled by markdownRenderer.
+const markdownExtensions = blackfriday.CommonExtensions | blackfriday.AutoHeadingIDs
+
+// renderMarkdown renders content to sanitized HTML. If base is set,
+// relative links and images are rewritten to point into the repo.
+func renderMarkdown(content string, base *markupBase) template.HTML {
+	unsafe, _ := markdownHTML(content)
+	return sanitizeMarkup(unsafe, base)
+}
+
+func markdownHTML(content string) ([]byte, error) {
+	r := &markdownRenderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+			Flags: blackfriday.CommonHTMLFlags,
+		}),
+		ids: headingIDs{},
+	}
+
+	return blackfriday.Run(
+		[]byte(content),
+		blackfriday.WithExtensions(markdownExtensions),
+		blackfriday.WithRenderer(r),
+	), nil
+}
+
+// markdownRenderer is blackfriday's HTML renderer with anchor links on
+// headings and task list checkboxes.
+type markdownRenderer struct {
+	*blackfriday.HTMLRenderer
+	ids headingIDs
+}
+
+func (r *markdownRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.Heading:
+		if entering && node.HeadingID != "" {
+			id := r.ids.unique(node.HeadingID)
+			node.HeadingID = ""
+			status := r.HTMLRenderer.RenderNode(w, node, entering)
+			io.WriteString(w, anchor(id))
+			return status
+		}
+	case blackfriday.Item:
+		if entering && taskMarker(node) != "" {
+			io.WriteString(w, `<li class="task">`)
+			return blackfriday.GoToNext
+		}
+	case blackfriday.Text:
+		if item := node.Parent.Parent; node.Prev == nil && node.Parent.Prev == nil && item != nil && item.Type == blackfriday.Item {
+			if m := taskMarker(item); m != "" {
+				checked := ""
+				if m != "[ ]" {
+					checked = " checked"
+				}
+				fmt.Fprintf(w, `<input type="checkbox" disabled%s> `, checked)
+				node.Literal = node.Literal[len(m)+1:]
+			}
+		}
+	}
+
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+// taskMarker returns the "[ ]" or "[x]" that opens a task list item, or ""
+// if item isn't one.
+func taskMarker(item *blackfriday.Node) string {
+	p := item.FirstChild
+	if p == nil || p.Type != blackfriday.Paragraph || p.FirstChild == nil || p.FirstChild.Type != blackfriday.Text {
+		return ""
+	}
+
+	text := p.FirstChild.Literal
+	for _, m := range []string{"[ ] ", "[x] ", "[X] "} {
+		if bytes.HasPrefix(text, []byte(m)) {
+			return m[:3]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,259 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+	"golang.org/x/net/html"
+)
+
+// markupBase is where a document lives, so relative links in it can point
+// somewhere useful.
+type markupBase struct {
+	name string
+	ref  string
+	// dir is the directory holding the document, relative to the repo
+	// root.
+	dir string
+}
+
+// A markupRenderer turns a document into HTML. The output doesn't need to
+// be safe; it's sanitized afterwards.
+type markupRenderer func(content string) ([]byte, error)
+
+// markupRenderers maps file extensions to the renderer for them.
+var markupRenderers = map[string]markupRenderer{
+	".md":       markdownHTML,
+	".mkd":      markdownHTML,
+	".markdown": markdownHTML,
+	".org":      orgHTML,
+	".rst":      rstHTML,
+	".rest":     rstHTML,
+	".adoc":     asciidocHTML,
+	".asciidoc": asciidocHTML,
+}
+
+// maxNesting is how deeply blocks and inline markup may nest in the
+// plain text markups before the rest is shown as it is.
+const maxNesting = 32
+
+// markupPolicy is the UGC policy plus what our renderers add.
+var markupPolicy = newMarkupPolicy()
+
+// filterPolicy is markupPolicy plus classes on the elements highlighters
+// like pygmentize and chroma hang their styles off, so filter output can
+// be styled from the stylesheet.
+var filterPolicy = func() *bluemonday.Policy {
+	p := newMarkupPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w -]+$`)).OnElements("span", "pre", "code")
+	return p
+}()
+
+func newMarkupPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(anchor|task|admonition)$`)).OnElements("a", "li", "div")
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)).OnElements("a", "h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+func isMarkup(name string) bool {
+	_, ok := markupRenderers[strings.ToLower(path.Ext(name))]
+	return ok
+}
+
+// renderMarkup renders content with the renderer for name's extension. It
+// returns false if there isn't one, or it failed.
+func renderMarkup(name, content string, base *markupBase) (template.HTML, bool) {
+	render, ok := markupRenderers[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return "", false
+	}
+
+	unsafe, err := render(content)
+	if err != nil {
+		log.Printf("rendering %s: %s", name, err)
+		return "", false
+	}
+	return sanitizeMarkup(unsafe, base), true
+}
+
+// sanitizeMarkup resolves relative links in rendered markup against base,
+// if set, and strips anything unsafe.
+func sanitizeMarkup(unsafe []byte, base *markupBase) template.HTML {
+	return sanitize(markupPolicy, unsafe, base)
+}
+
+// sanitizeFilter is sanitizeMarkup for the output of filters.
+func sanitizeFilter(unsafe []byte, base *markupBase) template.HTML {
+	return sanitize(filterPolicy, unsafe, base)
+}
+
+func sanitize(p *bluemonday.Policy, unsafe []byte, base *markupBase) template.HTML {
+	if base != nil {
+		unsafe = base.resolveLinks(unsafe)
+	}
+	return template.HTML(p.SanitizeBytes(unsafe))
+}
+
+// resolveLinks rewrites relative links in doc to point at files in the
+// repo: through the blob view for links, and the raw one for images.
+func (b *markupBase) resolveLinks(doc []byte) []byte {
+	var out bytes.Buffer
+
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				// Not much to salvage; let the sanitizer deal with
+				// the original.
+				return doc
+			}
+			return out.Bytes()
+		}
+
+		t := z.Token()
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			for i, a := range t.Attr {
+				switch {
+				case t.Data == "a" && a.Key == "href":
+					t.Attr[i].Val = b.resolve(a.Val, "blob")
+				case t.Data == "img" && a.Key == "src":
+					t.Attr[i].Val = b.resolve(a.Val, "raw")
+				}
+			}
+		}
+		out.WriteString(t.String())
+	}
+}
+
+// resolve rewrites a single relative link through the given view. Links
+// that climb out of the repo are left alone.
+func (b *markupBase) resolve(dest, view string) string {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return dest
+	}
+
+	// Absolute paths are relative to the root of the repo, like on
+	// most forges.
+	p := path.Clean(u.Path)
+	if strings.HasPrefix(p, "/") {
+		p = strings.TrimPrefix(p, "/")
+	} else {
+		p = path.Join(b.dir, p)
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return dest
+	}
+
+	u.Path = fmt.Sprintf("/%s/%s/%s/%s", b.name, view, b.ref, p)
+	return u.String()
+}
+
+// headingIDs hands out unique heading IDs within a document.
+type headingIDs map[string]int
+
+func (ids headingIDs) unique(id string) string {
+	n := ids[id]
+	ids[id]++
+	if n == 0 {
+		return id
+	}
+	return fmt.Sprintf("%s-%d", id, n)
+}
+
+// anchor is the link placed at the start of each heading.
+func anchor(id string) string {
+	return fmt.Sprintf(`<a id="%[1]s" class="anchor" href="#%[1]s">#</a>`, id)
+}
+
+// writeHeading writes a heading for the markup renderers that don't have
+// their own, with an ID made from its plain text.
+func writeHeading(w io.Writer, ids headingIDs, level int, text, inner string) {
+	id := ids.unique(blackfriday.SanitizedAnchorName(text))
+	fmt.Fprintf(w, "<h%d>%s%s</h%[1]d>\n", level, anchor(id), inner)
+}
+
+// inlineHTML escapes text, except where re matches; those matches are
+// replaced with whatever markup returns for their submatches, which it
+// must escape itself.
+func inlineHTML(text string, re *regexp.Regexp, markup func(m []string) string) string {
+	var sb strings.Builder
+
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(html.EscapeString(text[last:loc[0]]))
+
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = text[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		sb.WriteString(markup(m))
+		last = loc[1]
+	}
+	sb.WriteString(html.EscapeString(text[last:]))
+
+	return sb.String()
+}
+
+// lightLines splits a plain text markup document into lines, with tabs
+// expanded so indentation can be compared.
+func lightLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(strings.ReplaceAll(l, "\t", "        "), " ")
+	}
+	return lines
+}
+
+// indentOf returns how many spaces l starts with.
+func indentOf(l string) int {
+	return len(l) - len(strings.TrimLeft(l, " "))
+}
+
+// minIndent returns the smallest indentation of the non-blank lines.
+func minIndent(lines []string) int {
+	n := -1
+	for _, l := range lines {
+		if l != "" && (n < 0 || indentOf(l) < n) {
+			n = indentOf(l)
+		}
+	}
+	return max(n, 0)
+}
+
+// dedent removes n columns of indentation from each line, leaving blank
+// lines be.
+func dedent(lines []string, n int) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		if len(l) >= n && indentOf(l) >= n {
+			out[i] = l[n:]
+		} else {
+			out[i] = strings.TrimLeft(l, " ")
+		}
+	}
+	return out
+}
+
+func writePre(w io.Writer, lines []string) {
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	fmt.Fprintf(w, "<pre><code>%s</code></pre>\n", html.EscapeString(strings.Join(lines, "\n")))
+}
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"encoding/xml"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Extensions of files the blob view can preview inline, by the kind of
+// element used to show them.
+var mediaKinds = map[string]string{
+	".png":  "image",
+	".jpg":  "image",
+	".jpeg": "image",
+	".gif":  "image",
+	".webp": "image",
+	".avif": "image",
+	".bmp":  "image",
+	".ico":  "image",
+	".svg":  "image",
+	".mp4":  "video",
+	".m4v":  "video",
+	".webm": "video",
+	".ogv":  "video",
+	".mov":  "video",
+	".mp3":  "audio",
+	".m4a":  "audio",
+	".ogg":  "audio",
+	".oga":  "audio",
+	".opus": "audio",
+	".wav":  "audio",
+	".flac": "audio",
+	".pdf":  "pdf",
+}
+
+// mediaKind returns "image", "video", "audio" or "pdf" for files that can
+// be previewed inline, or "" for everything else.
+func mediaKind(name string) string {
+	return mediaKinds[strings.ToLower(filepath.Ext(name))]
+}
+
+// isSVG reports whether name is an SVG image, which unlike the other
+// media is text that can be read as source.
+func isSVG(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".svg")
+}
+
+// imageSize returns the pixel dimensions of an image file, if they can be
+// worked out without decoding the whole thing.
+func imageSize(f *object.File) (int, int, bool) {
+	r, err := f.Reader()
+	if err != nil {
+		return 0, 0, false
+	}
+	defer r.Close()
+
+	if isSVG(f.Name) {
+		return svgSize(r)
+	}
+
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// svgSize reads the width and height attributes off the root <svg>
+// element. Only plain numbers and px are understood.
+func svgSize(r io.Reader) (int, int, bool) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, false
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if se.Name.Local != "svg" {
+			return 0, 0, false
+		}
+
+		var w, h int
+		for _, a := range se.Attr {
+			switch a.Name.Local {
+			case "width":
+				w = svgLength(a.Value)
+			case "height":
+				h = svgLength(a.Value)
+			}
+		}
+		return w, h, w > 0 && h > 0
+	}
+}
+
+func svgLength(v string) int {
+	v = strings.TrimSuffix(strings.TrimSpace(v), "px")
+	n := 0
+	for _, c := range v {
+		if c == '.' {
+			break
+		}
+		if c < '0' || c > '9' {
+			return 0
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
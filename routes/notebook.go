@@ -0,0 +1,202 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+func isNotebook(name string) bool {
+	return strings.ToLower(path.Ext(name)) == ".ipynb"
+}
+
+// multiline is notebook text, which is either a string or a list of lines.
+type multiline string
+
+func (m *multiline) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*m = multiline(s)
+		return nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(b, &lines); err != nil {
+		return err
+	}
+	*m = multiline(strings.Join(lines, ""))
+	return nil
+}
+
+// ipynb is the parts of the Jupyter notebook format (v4) that we show.
+type ipynb struct {
+	Metadata struct {
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+	} `json:"metadata"`
+	Cells []struct {
+		CellType       string    `json:"cell_type"`
+		Source         multiline `json:"source"`
+		ExecutionCount *int      `json:"execution_count"`
+		Outputs        []struct {
+			OutputType string                     `json:"output_type"`
+			Text       multiline                  `json:"text"`
+			Data       map[string]json.RawMessage `json:"data"`
+			Traceback  []string                   `json:"traceback"`
+		} `json:"outputs"`
+	} `json:"cells"`
+}
+
+// notebookCell is a notebook cell ready for the template.
+type notebookCell struct {
+	Kind string
+	// Prompt is the execution count of code cells, if they've been run.
+	Prompt  string
+	Source  template.HTML
+	Outputs []notebookOutput
+}
+
+// notebookOutput is one output of a code cell; only one of its fields is
+// set.
+type notebookOutput struct {
+	Text  string
+	Error string
+	HTML  template.HTML
+	Image template.URL
+}
+
+// ansiEscape matches the terminal colour codes in tracebacks.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// readNotebook parses a Jupyter notebook into cells, with Markdown rendered
+// and code highlighted.
+func (d *deps) readNotebook(name, ref, p, content string) ([]notebookCell, error) {
+	var nb ipynb
+	if err := json.Unmarshal([]byte(content), &nb); err != nil {
+		return nil, fmt.Errorf("parsing notebook: %w", err)
+	}
+
+	lang := nb.Metadata.LanguageInfo.Name
+	if lang == "" {
+		lang = nb.Metadata.Kernelspec.Language
+	}
+	base := &markupBase{name: name, ref: ref, dir: path.Dir(p)}
+
+	cells := []notebookCell{}
+	for _, c := range nb.Cells {
+		cell := notebookCell{Kind: c.CellType}
+
+		switch c.CellType {
+		case "markdown":
+			cell.Source = renderMarkdown(string(c.Source), base)
+		case "code":
+			cell.Source = d.highlight(lang, string(c.Source))
+			if c.ExecutionCount != nil {
+				cell.Prompt = fmt.Sprint(*c.ExecutionCount)
+			}
+		default:
+			cell.Source = template.HTML("<pre>" + template.HTMLEscapeString(string(c.Source)) + "</pre>")
+		}
+
+		for _, o := range c.Outputs {
+			switch o.OutputType {
+			case "stream":
+				cell.Outputs = append(cell.Outputs, notebookOutput{Text: string(o.Text)})
+			case "error":
+				tb := ansiEscape.ReplaceAllString(strings.Join(o.Traceback, "\n"), "")
+				cell.Outputs = append(cell.Outputs, notebookOutput{Error: tb})
+			case "execute_result", "display_data":
+				if out, ok := displayData(o.Data, base); ok {
+					cell.Outputs = append(cell.Outputs, out)
+				}
+			}
+		}
+
+		cells = append(cells, cell)
+	}
+
+	return cells, nil
+}
+
+// displayData picks the richest representation of rich output that we can
+// show safely.
+func displayData(data map[string]json.RawMessage, base *markupBase) (notebookOutput, bool) {
+	text := func(mime string) (string, bool) {
+		raw, ok := data[mime]
+		if !ok {
+			return "", false
+		}
+		var m multiline
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return "", false
+		}
+		return string(m), true
+	}
+
+	for _, mime := range []string{"image/png", "image/jpeg", "image/gif"} {
+		if b64, ok := text(mime); ok {
+			b64 = strings.Join(strings.Fields(b64), "")
+			if _, err := base64.StdEncoding.DecodeString(b64); err == nil {
+				return notebookOutput{Image: template.URL("data:" + mime + ";base64," + b64)}, true
+			}
+		}
+	}
+	// SVG in an img can't run scripts.
+	if svg, ok := text("image/svg+xml"); ok {
+		b64 := base64.StdEncoding.EncodeToString([]byte(svg))
+		return notebookOutput{Image: template.URL("data:image/svg+xml;base64," + b64)}, true
+	}
+	if h, ok := text("text/html"); ok {
+		return notebookOutput{HTML: sanitizeMarkup([]byte(h), base)}, true
+	}
+	if md, ok := text("text/markdown"); ok {
+		return notebookOutput{HTML: renderMarkdown(md, base)}, true
+	}
+	if t, ok := text("text/plain"); ok {
+		return notebookOutput{Text: t}, true
+	}
+	return notebookOutput{}, false
+}
+
+// highlight highlights a snippet of code in lang, falling back to plain
+// text if there's no lexer for it or highlighting is turned off.
+func (d *deps) highlight(lang, code string) template.HTML {
+	plain := template.HTML("<pre>" + template.HTMLEscapeString(code) + "</pre>")
+	if d.c.Meta.SyntaxHighlight == "" {
+		return plain
+	}
+
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		return plain
+	}
+
+	style := styles.Get(d.c.Meta.SyntaxHighlight)
+	if style == nil {
+		style = styles.Get("monokailight")
+	}
+
+	iterator, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return plain
+	}
+
+	var buf bytes.Buffer
+	if err := html.New().Format(&buf, style, iterator); err != nil {
+		return plain
+	}
+	return template.HTML(buf.String())
+}
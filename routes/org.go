@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/niklasfasching/go-org/org"
+)
+
+func orgHTML(content string) ([]byte, error) {
+	conf := org.New()
+	conf.Log = log.New(io.Discard, "", 0)
+	// #+INCLUDE would otherwise read files off the server.
+	conf.ReadFile = func(string) ([]byte, error) {
+		return nil, errors.New("includes are not supported")
+	}
+	conf.DefaultSettings["OPTIONS"] = strings.Replace(conf.DefaultSettings["OPTIONS"], "toc:t", "toc:nil", 1)
+
+	w := &orgWriter{org.NewHTMLWriter()}
+	w.TopLevelHLevel = 1
+	w.ExtendingWriter = w
+
+	out, err := conf.Parse(strings.NewReader(content), "").Write(w)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+// orgWriter is go-org's HTML writer, adjusted for documents viewed in the
+// repo rather than exported to a website.
+type orgWriter struct {
+	*org.HTMLWriter
+}
+
+// WriteRegularLink leaves links to other Org files alone, rather than
+// pointing them at the HTML they'd be exported to.
+func (w *orgWriter) WriteRegularLink(l org.RegularLink) {
+	relative := l.Protocol == "file" || l.Protocol == ""
+	if !relative || l.Kind() != "regular" || !strings.HasSuffix(l.URL, ".org") {
+		w.HTMLWriter.WriteRegularLink(l)
+		return
+	}
+
+	url := strings.TrimPrefix(l.URL, "file:")
+	desc := html.EscapeString(url)
+	if l.Description != nil {
+		desc = w.WriteNodesAsString(l.Description...)
+	}
+	fmt.Fprintf(w, `<a href="%s">%s</a>`, html.EscapeString(url), desc)
+}
+
+// WriteListItem renders checkboxes, which go-org only marks with a class.
+func (w *orgWriter) WriteListItem(li org.ListItem) {
+	if li.Status == "" {
+		w.HTMLWriter.WriteListItem(li)
+		return
+	}
+
+	checkbox := `<li class="task"><input type="checkbox" disabled> `
+	if li.Status == "X" {
+		checkbox = `<li class="task"><input type="checkbox" disabled checked> `
+	}
+	li.Status = ""
+	item := w.WriteNodesAsString(li)
+	w.WriteString(strings.Replace(item, "<li>", checkbox, 1))
+}
@@ -0,0 +1,32 @@
+package routes
+
+import "testing"
+
+func TestOrgHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"checklist",
+			"- [X] done\n- [ ] todo\n",
+			"<ul>\n<li class=\"task\"><input type=\"checkbox\" disabled checked> done</li>\n<li class=\"task\"><input type=\"checkbox\" disabled> todo</li>\n</ul>\n",
+		},
+		{
+			"links",
+			"[[https://example.com][site]] and [[file:docs/a.org][a]]\n",
+			`<p><a href="https://example.com">site</a> and <a href="docs/a.org">a</a></p>` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orgHTML(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("orgHTML(%q) =\n%s\nwant\n%s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
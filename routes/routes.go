@@ -1,28 +1,50 @@
 package routes
 
 import (
-	"compress/gzip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"git.icyphox.sh/legit/cache"
 	"git.icyphox.sh/legit/config"
 	"git.icyphox.sh/legit/git"
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/dustin/go-humanize"
-	"github.com/microcosm-cc/bluemonday"
-	"github.com/russross/blackfriday/v2"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
+// releasesPerPage is how many releases are listed per page.
+const releasesPerPage = 10
+
+// logPerPage is how many commits the log shows per page.
+const logPerPage = 100
+
 type deps struct {
-	c *config.Config
+	c    *config.Config
+	keys *git.Keyring
+	// SHA-256 sums of release archives, keyed by prefix and commit.
+	sums *cache.LRU[string, string]
+	// Commits between releases, keyed by releaseKey.
+	ranges *cache.LRU[string, []releaseCommit]
+	// index is the site-wide search index, if one is configured.
+	index *git.Index
+	// warm queues work the index page would rather not wait for; see
+	// warmLoop.
+	warm chan func()
 }
 
 func (d *deps) Index(w http.ResponseWriter, r *http.Request) {
@@ -35,6 +57,8 @@ func (d *deps) Index(w http.ResponseWriter, r *http.Request) {
 
 	type info struct {
 		DisplayName, Name, Desc, Idle string
+		Languages                     []git.Language
+		Sparkline                     template.HTML
 		d                             time.Time
 	}
 
@@ -66,11 +90,44 @@ func (d *deps) Index(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// Working out languages means reading every file, which the
+		// index page can't afford for every repo at once; they show up
+		// once they've been worked out in the background.
+		var languages []git.Language
+		if mainBranch, err := gr.FindMainBranch(d.c.Repo.MainBranch); err == nil {
+			var ok bool
+			if languages, ok = d.cachedLanguages(path, mainBranch); !ok {
+				d.warmUp(func() {
+					if _, err := d.languages(path, mainBranch); err != nil {
+						log.Println(err)
+					}
+				})
+			}
+		}
+		// Only the main few are shown.
+		if len(languages) > 3 {
+			languages = languages[:3]
+		}
+
+		// Likewise for activity, which walks the whole history.
+		var sparkline template.HTML
+		if a, ok := gr.CachedActivity(); ok {
+			sparkline = sparklineSVG(a, time.Now())
+		} else {
+			d.warmUp(func() {
+				if _, err := gr.Activity(); err != nil {
+					log.Println(err)
+				}
+			})
+		}
+
 		infos = append(infos, info{
 			DisplayName: getDisplayName(name),
 			Name:        name,
 			Desc:        getDescription(path),
 			Idle:        humanize.Time(c.Author.When),
+			Languages:   languages,
+			Sparkline:   sparkline,
 			d:           c.Author.When,
 		})
 	}
@@ -85,6 +142,7 @@ func (d *deps) Index(w http.ResponseWriter, r *http.Request) {
 	data := make(map[string]interface{})
 	data["meta"] = d.c.Meta
 	data["info"] = infos
+	data["searchable"] = d.index != nil
 
 	if err := t.ExecuteTemplate(w, "index", data); err != nil {
 		log.Println(err)
@@ -119,38 +177,26 @@ func (d *deps) RepoIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var readmeContent template.HTML
-	for _, readme := range d.c.Repo.Readme {
-		ext := filepath.Ext(readme)
-		content, _ := gr.FileContent(readme)
-		if len(content) > 0 {
-			switch ext {
-			case ".md", ".mkd", ".markdown":
-				unsafe := blackfriday.Run(
-					[]byte(content),
-					blackfriday.WithExtensions(blackfriday.CommonExtensions),
-				)
-				html := bluemonday.UGCPolicy().SanitizeBytes(unsafe)
-				readmeContent = template.HTML(html)
-			default:
-				safe := bluemonday.UGCPolicy().SanitizeBytes([]byte(content))
-				readmeContent = template.HTML(
-					fmt.Sprintf(`<pre>%s</pre>`, safe),
-				)
-			}
-			break
-		}
+	mainBranch, err := gr.FindMainBranch(d.c.Repo.MainBranch)
+	if err != nil {
+		d.Write500(w)
+		log.Println(err)
+		return
 	}
 
-	if readmeContent == "" {
-		log.Printf("no readme found for %s", name)
+	languages, err := d.languages(path, mainBranch)
+	if err != nil {
+		log.Println(err)
 	}
 
-	mainBranch, err := gr.FindMainBranch(d.c.Repo.MainBranch)
+	activity, err := gr.Activity()
 	if err != nil {
-		d.Write500(w)
 		log.Println(err)
-		return
+	}
+
+	readmeContent := d.findReadme(gr, name, mainBranch, "")
+	if readmeContent == "" {
+		log.Printf("no readme found for %s", name)
 	}
 
 	tpath := filepath.Join(d.c.Dirs.Templates, "*")
@@ -166,10 +212,15 @@ func (d *deps) RepoIndex(w http.ResponseWriter, r *http.Request) {
 	data["ref"] = mainBranch
 	data["readme"] = readmeContent
 	data["commits"] = commits
+	data["authors"] = authors(gr, commits)
 	data["desc"] = getDescription(path)
 	data["servername"] = d.c.Server.Name
 	data["meta"] = d.c.Meta
 	data["gomod"] = isGoModule(gr)
+	data["languages"] = languages
+	if activity != nil && activity.Total > 0 {
+		data["heatmap"] = heatmapSVG(activity, time.Now())
+	}
 
 	if err := t.ExecuteTemplate(w, "repo", data); err != nil {
 		log.Println(err)
@@ -201,13 +252,24 @@ func (d *deps) RepoTree(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	files, err := gr.FileTree(treePath)
+	files, err := gr.FileTree(treePath, true)
 	if err != nil {
+		if sm, _ := gr.Submodule(treePath); sm != nil {
+			d.redirectSubmodule(w, r, name, sm)
+			return
+		}
 		d.Write500(w)
 		log.Println(err)
 		return
 	}
 
+	submodules := map[string]string{}
+	for _, f := range files {
+		if f.IsSubmodule {
+			submodules[f.Name] = d.submoduleLink(name, f.Submodule)
+		}
+	}
+
 	data := make(map[string]any)
 	data["name"] = name
 	data["displayname"] = getDisplayName(name)
@@ -215,17 +277,14 @@ func (d *deps) RepoTree(w http.ResponseWriter, r *http.Request) {
 	data["parent"] = treePath
 	data["desc"] = getDescription(path)
 	data["dotdot"] = filepath.Dir(treePath)
+	data["submodules"] = submodules
+	data["readme"] = d.findReadme(gr, name, ref, treePath)
 
 	d.listFiles(files, data, w)
 	return
 }
 
 func (d *deps) FileContent(w http.ResponseWriter, r *http.Request) {
-	var raw bool
-	if rawParam, err := strconv.ParseBool(r.URL.Query().Get("raw")); err == nil {
-		raw = rawParam
-	}
-
 	name := r.PathValue("name")
 	if d.isIgnored(name) {
 		d.Write404(w)
@@ -234,6 +293,12 @@ func (d *deps) FileContent(w http.ResponseWriter, r *http.Request) {
 	treePath := r.PathValue("rest")
 	ref := r.PathValue("ref")
 
+	// ?raw=true predates the raw endpoint; keep old links working.
+	if raw, err := strconv.ParseBool(r.URL.Query().Get("raw")); err == nil && raw {
+		http.Redirect(w, r, fmt.Sprintf("/%s/raw/%s/%s", name, ref, treePath), http.StatusMovedPermanently)
+		return
+	}
+
 	name = filepath.Clean(name)
 	path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
 	if err != nil {
@@ -248,8 +313,28 @@ func (d *deps) FileContent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	contents, err := gr.FileContent(treePath)
+	// Show what symlinks point at; the link itself is available raw.
+	// Broken, looping or escaping links just show their target path.
+	filePath := treePath
+	resolved, err := gr.ResolveSymlink(treePath)
+	if err != nil {
+		log.Printf("resolving %s: %s", treePath, err)
+	} else {
+		filePath = resolved
+	}
+
+	text, err := gr.FileContentLimit(filePath, d.c.Blob.MaxBytes)
 	if err != nil {
+		if sm, _ := gr.Submodule(filePath); sm != nil {
+			d.redirectSubmodule(w, r, name, sm)
+			return
+		}
+		if gr.IsDir(filePath) {
+			// Linked to a directory, either by a symlink or from a
+			// rendered document.
+			http.Redirect(w, r, fmt.Sprintf("/%s/tree/%s/%s", name, ref, filePath), http.StatusFound)
+			return
+		}
 		d.Write500(w)
 		return
 	}
@@ -259,16 +344,159 @@ func (d *deps) FileContent(w http.ResponseWriter, r *http.Request) {
 	data["ref"] = ref
 	data["desc"] = getDescription(path)
 	data["path"] = treePath
+	if filePath != treePath {
+		data["symlink"] = filePath
+	}
 
-	if raw {
-		d.showRaw(contents, w)
-	} else {
-		if d.c.Meta.SyntaxHighlight == "" {
-			d.showFile(contents, data, w)
-		} else {
-			d.showFileWithHighlight(treePath, contents, data, w)
+	// SVG is text as well as an image, and raw serves it as a download,
+	// so it gets the same source toggle as documents.
+	if kind := mediaKind(filePath); kind != "" {
+		plain, _ := strconv.ParseBool(r.URL.Query().Get("plain"))
+		if !isSVG(filePath) || !plain {
+			data["markup"] = isSVG(filePath)
+			d.showMedia(gr, kind, filePath, data, w)
+			return
+		}
+		data["markup"] = true
+		data["plain"] = true
+	}
+
+	contents, truncated := text.Content, text.Truncated
+	data["encoding"] = text.Encoding
+
+	lc, _ := countLines(strings.NewReader(contents))
+	if lc > d.c.Blob.MaxLines {
+		contents = firstLines(contents, d.c.Blob.MaxLines)
+		lc = d.c.Blob.MaxLines
+		truncated = true
+	}
+	data["truncated"] = truncated
+
+	// Documents and data are shown rendered unless the source is asked
+	// for. If rendering fails, the source is all there is, so there's
+	// nothing to toggle between.
+	if d.isRenderable(filePath) || isTable(filePath) || isNotebook(filePath) {
+		if truncated && isNotebook(filePath) {
+			// Half a notebook isn't valid JSON, so there's no
+			// rendering it.
+			data["norender"] = "notebook too large"
+		} else if plain, _ := strconv.ParseBool(r.URL.Query().Get("plain")); plain {
+			data["markup"] = true
+			data["plain"] = true
+		} else if d.showDocument(r, name, ref, filePath, contents, data, w) {
+			return
 		}
 	}
+
+	// Highlighting is by far the most expensive part of rendering a
+	// file, and pointless for minified code.
+	switch {
+	case d.c.Meta.SyntaxHighlight == "":
+		d.showFile(contents, data, w)
+	case int64(len(contents)) > d.c.Blob.MaxHighlightBytes || lc > d.c.Blob.MaxHighlightLines:
+		data["nohighlight"] = "file too large"
+		d.showFile(contents, data, w)
+	case isMinified(contents, lc):
+		data["nohighlight"] = "minified file"
+		d.showFile(contents, data, w)
+	default:
+		d.showFileWithHighlight(filePath, contents, data, w)
+	}
+}
+
+// Raw streams a blob as-is, with a sniffed Content-Type and support for
+// conditional and range requests.
+func (d *deps) Raw(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if d.isIgnored(name) {
+		d.Write404(w)
+		return
+	}
+	treePath := r.PathValue("rest")
+	ref := r.PathValue("ref")
+
+	name = filepath.Clean(name)
+	path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
+	if err != nil {
+		log.Printf("securejoin error: %v", err)
+		d.Write404(w)
+		return
+	}
+
+	gr, err := git.Open(path, ref)
+	if err != nil {
+		d.Write404(w)
+		return
+	}
+
+	file, err := gr.File(treePath)
+	if err != nil {
+		d.Write404(w)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s"`, file.Hash)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	reader, err := file.Reader()
+	if err != nil {
+		d.Write500(w)
+		log.Println(err)
+		return
+	}
+	defer reader.Close()
+
+	br := bufio.NewReader(reader)
+	head, _ := br.Peek(512)
+	ctype := sniffContentType(treePath, head)
+
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Browsers refuse to show PDFs in a sandbox, and their viewers keep
+	// any scripts in them contained anyway.
+	if !strings.HasPrefix(ctype, "application/pdf") {
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	}
+	if d.isAttachment(ctype) {
+		setContentDisposition(w, "attachment", filepath.Base(treePath))
+	}
+
+	start, length := int64(0), file.Size
+	if rh := r.Header.Get("Range"); rh != "" {
+		var ok bool
+		start, length, ok = parseRange(rh, file.Size)
+		if !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if length != file.Size {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, file.Size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.CopyN(io.Discard, br, start); err != nil {
+		log.Println(err)
+		return
+	}
+	if _, err := io.CopyN(w, br, length); err != nil {
+		// Headers are already out; all we can do is log it.
+		log.Println(err)
+	}
 }
 
 func (d *deps) Archive(w http.ResponseWriter, r *http.Request) {
@@ -281,19 +509,75 @@ func (d *deps) Archive(w http.ResponseWriter, r *http.Request) {
 	file := r.PathValue("file")
 
 	// TODO: extend this to add more files compression (e.g.: xz)
-	if !strings.HasSuffix(file, ".tar.gz") {
+	ref, checksum := strings.CutSuffix(file, ".tar.gz.sha256")
+	if !checksum {
+		var ok bool
+		if ref, ok = strings.CutSuffix(file, ".tar.gz"); !ok {
+			d.Write404(w)
+			return
+		}
+	}
+
+	path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
+	if err != nil {
+		log.Printf("securejoin error: %v", err)
 		d.Write404(w)
 		return
 	}
 
-	ref := strings.TrimSuffix(file, ".tar.gz")
+	gr, err := git.Open(path, ref)
+	if err != nil {
+		d.Write404(w)
+		return
+	}
+
+	c, err := gr.LastCommit()
+	if err != nil {
+		d.Write500(w)
+		log.Println(err)
+		return
+	}
+
+	prefix := fmt.Sprintf("%s-%s", name, ref)
+	filename := prefix + ".tar.gz"
+
+	if checksum {
+		sum, err := d.archiveChecksum(gr, prefix, c.Hash.String())
+		if err != nil {
+			d.Write500(w)
+			log.Println(err)
+			return
+		}
+		setMIME(w, "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "%s  %s\n", sum, filename)
+		return
+	}
 
 	// This allows the browser to use a proper name for the file when
 	// downloading
-	filename := fmt.Sprintf("%s-%s.tar.gz", name, ref)
-	setContentDisposition(w, filename)
+	setContentDisposition(w, "inline", filename)
 	setGZipMIME(w)
 
+	// Work out the checksum on the way past, so the releases page can
+	// show it without building the archive itself.
+	h := sha256.New()
+	err = writeArchive(io.MultiWriter(w, h), gr, prefix)
+	if err != nil {
+		// once we start writing to the body we can't report error anymore
+		// so we are only left with printing the error.
+		log.Println(err)
+		return
+	}
+	d.sums.Add(archiveKey(prefix, c.Hash.String()), hex.EncodeToString(h.Sum(nil)))
+}
+
+func (d *deps) Tag(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if d.isIgnored(name) {
+		d.Write404(w)
+		return
+	}
+
 	path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
 	if err != nil {
 		log.Printf("securejoin error: %v", err)
@@ -301,33 +585,190 @@ func (d *deps) Archive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	gr, err := git.Open(path, ref)
+	gr, err := git.Open(path, "")
 	if err != nil {
 		d.Write404(w)
 		return
 	}
 
-	gw := gzip.NewWriter(w)
-	defer gw.Close()
-
-	prefix := fmt.Sprintf("%s-%s", name, ref)
-	err = gr.WriteTar(gw, prefix)
+	tag, err := gr.Tag(r.PathValue("tag"))
 	if err != nil {
-		// once we start writing to the body we can't report error anymore
-		// so we are only left with printing the error.
+		d.Write404(w)
+		return
+	}
+
+	tpath := filepath.Join(d.c.Dirs.Templates, "*")
+	t := template.Must(template.ParseGlob(tpath))
+
+	data := make(map[string]interface{})
+	data["meta"] = d.c.Meta
+	data["name"] = name
+	data["displayname"] = getDisplayName(name)
+	data["desc"] = getDescription(path)
+	data["tag"] = tag
+	data["signature"] = d.keys.VerifyTag(tag)
+
+	if err := t.ExecuteTemplate(w, "tag", data); err != nil {
 		log.Println(err)
 		return
 	}
+}
+
+func (d *deps) Releases(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if d.isIgnored(name) {
+		d.Write404(w)
+		return
+	}
 
-	err = gw.Flush()
+	path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
 	if err != nil {
-		// once we start writing to the body we can't report error anymore
-		// so we are only left with printing the error.
+		log.Printf("securejoin error: %v", err)
+		d.Write404(w)
+		return
+	}
+
+	gr, err := git.Open(path, "")
+	if err != nil {
+		d.Write404(w)
+		return
+	}
+
+	tags, err := gr.Tags()
+	if err != nil {
+		d.Write500(w)
 		log.Println(err)
 		return
 	}
+
+	type release struct {
+		Tag       *git.TagReference
+		Notes     template.HTML
+		Commits   []releaseCommit
+		Signature git.Verification
+		Archive   string
+		Checksum  string
+	}
+
+	// Tags on trees and blobs aren't releases of anything.
+	tags = slices.DeleteFunc(tags, func(t *git.TagReference) bool {
+		return t.Commit() == nil
+	})
+
+	pages := max((len(tags)+releasesPerPage-1)/releasesPerPage, 1)
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = min(max(page, 1), pages)
+	start := (page - 1) * releasesPerPage
+	end := min(start+releasesPerPage, len(tags))
+
+	releases := []release{}
+	for i := start; i < end; i++ {
+		tag := tags[i]
+		prefix := fmt.Sprintf("%s-%s", name, tag.Name())
+		rel := release{
+			Tag:       tag,
+			Notes:     renderMarkdown(tag.Message(), &markupBase{name: name, ref: tag.Name()}),
+			Signature: d.keys.VerifyTag(tag),
+			Archive:   fmt.Sprintf("%s.tar.gz", tag.Name()),
+			// Only shown once someone's downloaded the archive, or
+			// asked for its .sha256; working it out here would mean
+			// building every release's tarball.
+			Checksum: d.cachedChecksum(prefix, tag.Target()),
+		}
+
+		// Tags are sorted newest first, so the previous release is
+		// the next one along.
+		var prev string
+		if i+1 < len(tags) {
+			prev = tags[i+1].Target()
+		}
+		rel.Commits = d.releaseCommits(path, tag.Target(), prev)
+
+		releases = append(releases, rel)
+	}
+
+	tpath := filepath.Join(d.c.Dirs.Templates, "*")
+	t := template.Must(template.ParseGlob(tpath))
+
+	data := make(map[string]interface{})
+	data["meta"] = d.c.Meta
+	data["name"] = name
+	data["displayname"] = getDisplayName(name)
+	data["desc"] = getDescription(path)
+	data["releases"] = releases
+	data["page"] = page
+	data["pages"] = pages
+	if page > 1 {
+		data["prev"] = page - 1
+	}
+	if page < pages {
+		data["next"] = page + 1
+	}
+
+	if err := t.ExecuteTemplate(w, "releases", data); err != nil {
+		log.Println(err)
+		return
+	}
+}
+
+// releaseCommit is a commit as listed under a release.
+type releaseCommit struct {
+	Hash, Subject, Author string
 }
 
+// releaseKey identifies the commits between two releases by the commits
+// they point at. Tags don't move, so neither does what's between them.
+func releaseKey(target, prev string) string {
+	return prev + ".." + target
+}
+
+// releaseCommits lists the commits in the repo at path that are in
+// target but not prev, or all of target's history if prev is "".
+func (d *deps) releaseCommits(path, target, prev string) []releaseCommit {
+	key := releaseKey(target, prev)
+	if commits, ok := d.ranges.Get(key); ok {
+		return commits
+	}
+
+	gr, err := git.Open(path, target)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	mm, err := gr.Mailmap()
+	if err != nil {
+		log.Println(err)
+	}
+
+	var cs []*object.Commit
+	if prev != "" {
+		cs, err = gr.CommitRange(prev)
+	} else {
+		cs, err = gr.Commits()
+	}
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	commits := make([]releaseCommit, 0, len(cs))
+	for _, c := range cs {
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		commits = append(commits, releaseCommit{
+			Hash:    c.Hash.String(),
+			Subject: subject,
+			Author:  mm.Map(c.Author).Name,
+		})
+	}
+	d.ranges.Add(key, commits)
+	return commits
+}
+
+// Log lists the history of ref, logPerPage commits at a time with ?page=.
+// It can be filtered with ?author=, ?committer=, ?grep= (?re=1 for a
+// regular expression), ?since= and ?until= as YYYY-MM-DD, and
+// ?nomerges=1.
 func (d *deps) Log(w http.ResponseWriter, r *http.Request) {
 	name := r.PathValue("name")
 	if d.isIgnored(name) {
@@ -349,24 +790,88 @@ func (d *deps) Log(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	commits, err := gr.Commits()
-	if err != nil {
+	data := make(map[string]interface{})
+
+	q := r.URL.Query()
+	filter := git.CommitFilter{
+		Author:    q.Get("author"),
+		Committer: q.Get("committer"),
+		Message:   q.Get("grep"),
+	}
+	filter.MessageRegexp, _ = strconv.ParseBool(q.Get("re"))
+	filter.NoMerges, _ = strconv.ParseBool(q.Get("nomerges"))
+
+	var dateErr error
+	if filter.Since, err = parseDay(q.Get("since")); err != nil {
+		dateErr = err
+	}
+	if until, err := parseDay(q.Get("until")); err != nil {
+		dateErr = err
+	} else if !until.IsZero() {
+		// Until the end of the day.
+		filter.Until = until.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	page = max(page, 1)
+
+	commits, more, err := gr.CommitsPage(filter, (page-1)*logPerPage, logPerPage)
+	switch {
+	case dateErr != nil:
+		data["error"] = dateErr.Error()
+		commits = nil
+	case errors.Is(err, git.ErrBadQuery):
+		data["error"] = err.Error()
+	case err != nil:
 		d.Write500(w)
 		log.Println(err)
 		return
 	}
 
+	gn, err := gr.Notes(d.c.Repo.Notes)
+	if err != nil {
+		log.Println(err)
+	}
+
+	signatures := map[string]git.Verification{}
+	notes := map[string][]git.Note{}
+	for _, c := range commits {
+		if v := d.keys.VerifyCommit(c); v.Status != "" {
+			signatures[c.Hash.String()] = v
+		}
+		if n := gn.Get(c.Hash); n != nil {
+			notes[c.Hash.String()] = n
+		}
+	}
+
 	tpath := filepath.Join(d.c.Dirs.Templates, "*")
 	t := template.Must(template.ParseGlob(tpath))
 
-	data := make(map[string]interface{})
 	data["commits"] = commits
+	data["authors"] = authors(gr, commits)
+	data["signatures"] = signatures
+	data["notes"] = notes
 	data["meta"] = d.c.Meta
 	data["name"] = name
 	data["displayname"] = getDisplayName(name)
 	data["ref"] = ref
 	data["desc"] = getDescription(path)
 	data["log"] = true
+	data["filter"] = filter
+	data["filtered"] = !filter.IsZero() || data["error"] != nil
+	data["since"] = q.Get("since")
+	data["until"] = q.Get("until")
+
+	// The pager keeps the filter, so it's built from the query as is.
+	data["page"] = page
+	if page > 1 {
+		q.Set("page", strconv.Itoa(page-1))
+		data["prev"] = template.URL("?" + q.Encode())
+	}
+	if more {
+		q.Set("page", strconv.Itoa(page+1))
+		data["next"] = template.URL("?" + q.Encode())
+	}
 
 	if err := t.ExecuteTemplate(w, "log", data); err != nil {
 		log.Println(err)
@@ -374,6 +879,200 @@ func (d *deps) Log(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// SiteSearch searches the names and descriptions, commit messages and
+// files of every listed repository's main branch, as last indexed.
+func (d *deps) SiteSearch(w http.ResponseWriter, r *http.Request) {
+	if d.index == nil {
+		d.Write404(w)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	data := make(map[string]any)
+	data["meta"] = d.c.Meta
+	data["sitesearch"] = true
+	data["q"] = q
+
+	if q != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), d.c.Search.Timeout)
+		defer cancel()
+
+		res := d.index.Search(ctx, q, d.c.Search.MaxMatches)
+
+		displayNames := map[string]string{}
+		for _, repo := range res.Repos {
+			displayNames[repo.Name] = getDisplayName(repo.Name)
+		}
+		for _, c := range res.Commits {
+			displayNames[c.Repo] = getDisplayName(c.Repo)
+		}
+		for _, f := range res.Files {
+			displayNames[f.Repo] = getDisplayName(f.Repo)
+		}
+		data["results"] = res
+		data["displaynames"] = displayNames
+	}
+
+	tpath := filepath.Join(d.c.Dirs.Templates, "*")
+	t := template.Must(template.ParseGlob(tpath))
+
+	if err := t.ExecuteTemplate(w, "sitesearch", data); err != nil {
+		log.Println(err)
+		return
+	}
+}
+
+// warmLoop runs the jobs queued with warmUp, one at a time.
+func (d *deps) warmLoop() {
+	for f := range d.warm {
+		f()
+	}
+}
+
+// warmUp queues f to be run by warmLoop, unless the queue is full; it'll
+// be asked for again on the next page load.
+func (d *deps) warmUp(f func()) {
+	select {
+	case d.warm <- f:
+	default:
+	}
+}
+
+// indexLoop keeps the site-wide search index up to date, looking for
+// pushes every search.refresh.
+func (d *deps) indexLoop() {
+	t := time.NewTicker(d.c.Search.Refresh)
+	defer t.Stop()
+	for {
+		d.refreshIndex()
+		<-t.C
+	}
+}
+
+// refreshIndex updates the site-wide search index for the repositories
+// on the index page, and drops any that have gone.
+func (d *deps) refreshIndex() {
+	dirs, err := os.ReadDir(d.c.Repo.ScanPath)
+	if err != nil {
+		log.Printf("reading scan path: %s", err)
+		return
+	}
+
+	// Only repos that are gone are pruned; one that failed to update
+	// keeps what was indexed before.
+	var names []string
+	for _, dir := range dirs {
+		name := dir.Name()
+		if !dir.IsDir() || d.isIgnored(name) || d.isUnlisted(name) {
+			continue
+		}
+		names = append(names, name)
+
+		path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
+		if err != nil {
+			log.Printf("securejoin error: %v", err)
+			continue
+		}
+
+		if err := d.index.Update(name, path, getDescription(path), d.c.Repo.MainBranch); err != nil {
+			log.Printf("index: %s: %s", name, err)
+		}
+	}
+
+	d.index.Prune(names)
+}
+
+// parseDay parses a date as sent by a date input, returning the zero time
+// if it's empty.
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// searchContext is how many lines are shown around code search matches.
+const searchContext = 2
+
+// Search greps the tree at ref. Literal text is matched by default; ?re=1
+// takes a regular expression, ?case=1 matches case, and ?path= limits the
+// search to files matching a glob.
+func (d *deps) Search(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if d.isIgnored(name) {
+		d.Write404(w)
+		return
+	}
+	ref := r.PathValue("ref")
+
+	path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
+	if err != nil {
+		log.Printf("securejoin error: %v", err)
+		d.Write404(w)
+		return
+	}
+
+	gr, err := git.Open(path, ref)
+	if err != nil {
+		d.Write404(w)
+		return
+	}
+
+	q := r.URL.Query()
+	opts := git.SearchOptions{
+		Query:        q.Get("q"),
+		Path:         q.Get("path"),
+		Context:      searchContext,
+		MaxMatches:   d.c.Search.MaxMatches,
+		MaxFileBytes: d.c.Search.MaxFileBytes,
+	}
+	opts.Regexp, _ = strconv.ParseBool(q.Get("re"))
+	matchCase, _ := strconv.ParseBool(q.Get("case"))
+	opts.IgnoreCase = !matchCase
+
+	data := make(map[string]any)
+	data["meta"] = d.c.Meta
+	data["name"] = name
+	data["displayname"] = getDisplayName(name)
+	data["ref"] = ref
+	data["desc"] = getDescription(path)
+	data["search"] = true
+	data["q"] = opts.Query
+	data["re"] = opts.Regexp
+	data["case"] = matchCase
+	data["glob"] = opts.Path
+
+	if opts.Query != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), d.c.Search.Timeout)
+		defer cancel()
+
+		res, err := gr.Search(ctx, opts)
+		switch {
+		case errors.Is(err, git.ErrBadQuery):
+			data["error"] = err.Error()
+		case err != nil:
+			d.Write500(w)
+			log.Println(err)
+			return
+		default:
+			data["results"] = res
+		}
+	}
+
+	tpath := filepath.Join(d.c.Dirs.Templates, "*")
+	t := template.Must(template.ParseGlob(tpath))
+
+	if err := t.ExecuteTemplate(w, "search", data); err != nil {
+		log.Println(err)
+		return
+	}
+}
+
 func (d *deps) Diff(w http.ResponseWriter, r *http.Request) {
 	name := r.PathValue("name")
 	if d.isIgnored(name) {
@@ -388,25 +1087,67 @@ func (d *deps) Diff(w http.ResponseWriter, r *http.Request) {
 		d.Write404(w)
 		return
 	}
+
+	if rev, ok := strings.CutSuffix(ref, ".patch"); ok {
+		d.writePatch(w, path, rev, "", false, false)
+		return
+	}
+	if rev, ok := strings.CutSuffix(ref, ".diff"); ok {
+		d.writePatch(w, path, rev, "", true, false)
+		return
+	}
+
 	gr, err := git.Open(path, ref)
 	if err != nil {
 		d.Write404(w)
 		return
 	}
 
-	diff, err := gr.Diff()
+	opts := git.DiffOptions{
+		Context:      -1,
+		Path:         r.PathValue("rest"),
+		MaxFiles:     d.c.Diff.MaxFiles,
+		MaxLines:     d.c.Diff.MaxLines,
+		MaxFileLines: d.c.Diff.MaxFileLines,
+	}
+	if ctx, err := strconv.Atoi(r.URL.Query().Get("context")); err == nil {
+		opts.Context = ctx
+	}
+	if ws, err := strconv.ParseBool(r.URL.Query().Get("w")); err == nil {
+		opts.IgnoreWhitespace = ws
+	}
+
+	diff, err := gr.Diff(opts)
+	if err != nil {
+		d.Write500(w)
+		log.Println(err)
+		return
+	}
+
+	if opts.Path != "" && len(diff.Diff) == 0 {
+		d.Write404(w)
+		return
+	}
+
+	c, err := gr.LastCommit()
 	if err != nil {
 		d.Write500(w)
 		log.Println(err)
 		return
 	}
 
+	notes, err := gr.Notes(d.c.Repo.Notes)
+	if err != nil {
+		log.Println(err)
+	}
+
 	tpath := filepath.Join(d.c.Dirs.Templates, "*")
 	t := template.Must(template.ParseGlob(tpath))
 
 	data := make(map[string]interface{})
 
 	data["commit"] = diff.Commit
+	data["notes"] = notes.Get(c.Hash)
 	data["stat"] = diff.Stat
 	data["diff"] = diff.Diff
 	data["meta"] = d.c.Meta
@@ -414,6 +1155,19 @@ func (d *deps) Diff(w http.ResponseWriter, r *http.Request) {
 	data["displayname"] = getDisplayName(name)
 	data["ref"] = ref
 	data["desc"] = getDescription(path)
+	data["context"] = opts.Context
+	data["file"] = opts.Path
+	data["ignorews"] = opts.IgnoreWhitespace
+	data["signature"] = d.keys.VerifyCommit(c)
+	data["message"] = d.filterMessage(name, diff.Commit.This, diff.Commit.Message)
+
+	images := map[string]bool{}
+	for _, f := range diff.Diff {
+		if mediaKind(f.Path()) == "image" {
+			images[f.Path()] = true
+		}
+	}
+	data["images"] = images
 
 	if err := t.ExecuteTemplate(w, "commit", data); err != nil {
 		log.Println(err)
@@ -421,6 +1175,51 @@ func (d *deps) Diff(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Compare serves base..head and base...head ranges as either a
+// format-patch series (.patch) or a unified diff (.diff).
+func (d *deps) Compare(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if d.isIgnored(name) {
+		d.Write404(w)
+		return
+	}
+
+	path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
+	if err != nil {
+		log.Printf("securejoin error: %v", err)
+		d.Write404(w)
+		return
+	}
+
+	rng := r.PathValue("range")
+	asDiff := false
+	if rev, ok := strings.CutSuffix(rng, ".patch"); ok {
+		rng = rev
+	} else if rev, ok := strings.CutSuffix(rng, ".diff"); ok {
+		rng = rev
+		asDiff = true
+	} else {
+		d.Write404(w)
+		return
+	}
+
+	base, head, ok := strings.Cut(rng, "..")
+	if !ok || base == "" || head == "" {
+		d.Write404(w)
+		return
+	}
+
+	// base...head diffs against the merge base, like git diff does. A
+	// patch series is the same for both forms.
+	mergeBase := false
+	if rest, ok := strings.CutPrefix(head, "."); ok {
+		head = rest
+		mergeBase = true
+	}
+
+	d.writePatch(w, path, head, base, asDiff, mergeBase)
+}
+
 func (d *deps) Refs(w http.ResponseWriter, r *http.Request) {
 	name := r.PathValue("name")
 	if d.isIgnored(name) {
@@ -454,6 +1253,13 @@ func (d *deps) Refs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	signatures := map[string]git.Verification{}
+	for _, t := range tags {
+		if v := d.keys.VerifyTag(t); v.Status != "" {
+			signatures[t.Name()] = v
+		}
+	}
+
 	tpath := filepath.Join(d.c.Dirs.Templates, "*")
 	t := template.Must(template.ParseGlob(tpath))
 
@@ -464,6 +1270,7 @@ func (d *deps) Refs(w http.ResponseWriter, r *http.Request) {
 	data["displayname"] = getDisplayName(name)
 	data["branches"] = branches
 	data["tags"] = tags
+	data["signatures"] = signatures
 	data["desc"] = getDescription(path)
 
 	if err := t.ExecuteTemplate(w, "refs", data); err != nil {
@@ -472,6 +1279,98 @@ func (d *deps) Refs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Activity shows when the history of HEAD was written.
+func (d *deps) Activity(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if d.isIgnored(name) {
+		d.Write404(w)
+		return
+	}
+
+	path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
+	if err != nil {
+		log.Printf("securejoin error: %v", err)
+		d.Write404(w)
+		return
+	}
+
+	gr, err := git.Open(path, "")
+	if err != nil {
+		d.Write404(w)
+		return
+	}
+
+	activity, err := gr.Activity()
+	if err != nil {
+		log.Println(err)
+		d.Write500(w)
+		return
+	}
+
+	tpath := filepath.Join(d.c.Dirs.Templates, "*")
+	t := template.Must(template.ParseGlob(tpath))
+
+	data := make(map[string]interface{})
+
+	data["meta"] = d.c.Meta
+	data["name"] = name
+	data["displayname"] = getDisplayName(name)
+	data["desc"] = getDescription(path)
+	data["activity"] = activity
+	data["heatmap"] = heatmapSVG(activity, time.Now())
+	data["punchcard"] = punchCardSVG(activity)
+
+	if err := t.ExecuteTemplate(w, "activity", data); err != nil {
+		log.Println(err)
+		return
+	}
+}
+
+// Contributors lists who wrote the history of HEAD.
+func (d *deps) Contributors(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if d.isIgnored(name) {
+		d.Write404(w)
+		return
+	}
+
+	path, err := securejoin.SecureJoin(d.c.Repo.ScanPath, name)
+	if err != nil {
+		log.Printf("securejoin error: %v", err)
+		d.Write404(w)
+		return
+	}
+
+	gr, err := git.Open(path, "")
+	if err != nil {
+		d.Write404(w)
+		return
+	}
+
+	contributors, err := gr.Contributors()
+	if err != nil {
+		log.Println(err)
+		d.Write500(w)
+		return
+	}
+
+	tpath := filepath.Join(d.c.Dirs.Templates, "*")
+	t := template.Must(template.ParseGlob(tpath))
+
+	data := make(map[string]interface{})
+
+	data["meta"] = d.c.Meta
+	data["name"] = name
+	data["displayname"] = getDisplayName(name)
+	data["desc"] = getDescription(path)
+	data["contributors"] = contributors
+
+	if err := t.ExecuteTemplate(w, "contributors", data); err != nil {
+		log.Println(err)
+		return
+	}
+}
+
 func (d *deps) ServeStatic(w http.ResponseWriter, r *http.Request) {
 	f := r.PathValue("file")
 	f = filepath.Clean(f)
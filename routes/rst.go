@@ -0,0 +1,347 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// A subset of reStructuredText: sections, paragraphs, lists, literal and
+// code blocks, block quotes, images, admonitions, and the common inline
+// markup. Anything else comes out as plain text.
+
+var (
+	rstBullet     = regexp.MustCompile(`^([-*+•])( +)`)
+	rstEnumerated = regexp.MustCompile(`^((?:\d+|#)[.)])( +)`)
+	rstDirective  = regexp.MustCompile(`^\.\. +([\w:-]+)::(?: +(.*))?$`)
+	rstTarget     = regexp.MustCompile(`^\.\. +_([^:]+): +(\S+)$`)
+	rstField      = regexp.MustCompile(`^:([^:]+): *(.*)$`)
+	rstInline     = regexp.MustCompile("``(.+?)``" +
+		"|`([^`<]+?) *<([^>]+)>`__?" +
+		"|`([^`]+)`__?" +
+		"|:([\\w-]+):`([^`]+)`" +
+		"|`([^`]+)`" +
+		`|\*\*(.+?)\*\*` +
+		`|\*([^*\s](?:[^*]*[^*\s])?)\*` +
+		`|(https?://[^\s<>]*[^\s<>.,;:!?)\]'"])`)
+)
+
+var rstAdmonitions = map[string]bool{
+	"attention": true, "caution": true, "danger": true, "error": true,
+	"hint": true, "important": true, "note": true, "tip": true,
+	"warning": true, "seealso": true,
+}
+
+type rstWriter struct {
+	bytes.Buffer
+	ids headingIDs
+	// styles lists section title adornments in the order they're first
+	// seen, which is what decides their levels.
+	styles []string
+	// targets are named hyperlink targets, for `name`_ references.
+	targets map[string]string
+	// depth is how many blocks deep the writer is.
+	depth int
+}
+
+func rstHTML(content string) ([]byte, error) {
+	lines := lightLines(content)
+
+	w := &rstWriter{ids: headingIDs{}, targets: map[string]string{}}
+	for _, l := range lines {
+		if m := rstTarget.FindStringSubmatch(l); m != nil {
+			w.targets[strings.ToLower(m[1])] = m[2]
+		}
+	}
+
+	w.blocks(lines)
+	return w.Bytes(), nil
+}
+
+// isAdornment reports whether l is a line of one repeated punctuation
+// character, as used for section titles and transitions.
+func isAdornment(l string) bool {
+	if len(l) < 2 {
+		return false
+	}
+	c := l[0]
+	if !strings.ContainsRune("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", rune(c)) {
+		return false
+	}
+	return strings.Count(l, string(c)) == len(l)
+}
+
+// block returns the lines from i that are blank or indented by at least
+// n, minus trailing blank lines, and the index after them.
+func block(lines []string, i, n int) ([]string, int) {
+	start := i
+	for i < len(lines) && (lines[i] == "" || indentOf(lines[i]) >= n) {
+		i++
+	}
+	end := i
+	for end > start && lines[end-1] == "" {
+		end--
+	}
+	return lines[start:end], end
+}
+
+func (w *rstWriter) blocks(lines []string) {
+	w.depth++
+	defer func() { w.depth-- }()
+	if w.depth > maxNesting {
+		writePre(w, lines)
+		return
+	}
+
+	for i := 0; i < len(lines); {
+		l := lines[i]
+
+		switch {
+		case l == "":
+			i++
+
+		// Section titles with an overline.
+		case isAdornment(l) && i+2 < len(lines) && lines[i+2] == l && lines[i+1] != "":
+			w.heading("o"+l[:1], strings.TrimSpace(lines[i+1]))
+			i += 3
+
+		// Section titles with just an underline.
+		case indentOf(l) == 0 && i+1 < len(lines) && isAdornment(lines[i+1]) && !isAdornment(l) &&
+			len(lines[i+1]) >= utf8.RuneCountInString(l):
+			w.heading(lines[i+1][:1], l)
+			i += 2
+
+		case isAdornment(l) && len(l) >= 4 && (i+1 == len(lines) || lines[i+1] == ""):
+			w.WriteString("<hr>\n")
+			i++
+
+		case rstTarget.MatchString(l):
+			i++
+
+		case strings.HasPrefix(l, ".."):
+			i = w.directive(lines, i)
+
+		case rstBullet.MatchString(l):
+			i = w.list(lines, i, rstBullet, "ul")
+
+		case rstEnumerated.MatchString(l):
+			i = w.list(lines, i, rstEnumerated, "ol")
+
+		case indentOf(l) > 0:
+			var quote []string
+			quote, i = block(lines, i, 1)
+			w.WriteString("<blockquote>\n")
+			w.blocks(dedent(quote, indentOf(l)))
+			w.WriteString("</blockquote>\n")
+
+		case rstField.MatchString(l) && (i == 0 || lines[i-1] == ""):
+			i = w.fields(lines, i)
+
+		case strings.HasPrefix(l, "+-") || strings.HasPrefix(l, "=="):
+			// Tables keep their ASCII art.
+			start := i
+			for i < len(lines) && lines[i] != "" {
+				i++
+			}
+			writePre(w, lines[start:i])
+
+		default:
+			i = w.paragraph(lines, i)
+		}
+	}
+}
+
+func (w *rstWriter) heading(style, title string) {
+	level := len(w.styles) + 1
+	for n, s := range w.styles {
+		if s == style {
+			level = n + 1
+		}
+	}
+	if level > len(w.styles) {
+		w.styles = append(w.styles, style)
+	}
+
+	writeHeading(w, w.ids, min(level, 6), title, w.inline(title))
+}
+
+func (w *rstWriter) paragraph(lines []string, i int) int {
+	var para []string
+	for ; i < len(lines) && lines[i] != ""; i++ {
+		// A title starts right here.
+		if len(para) > 0 && i+1 < len(lines) && isAdornment(lines[i+1]) && !isAdornment(lines[i]) {
+			break
+		}
+		para = append(para, strings.TrimSpace(lines[i]))
+	}
+
+	text := strings.Join(para, "\n")
+	literal := strings.HasSuffix(text, "::")
+	if literal {
+		switch {
+		case text == "::":
+			text = ""
+		case strings.HasSuffix(text, " ::"):
+			text = strings.TrimSuffix(text, " ::")
+		default:
+			text = strings.TrimSuffix(text, ":")
+		}
+	}
+
+	if text != "" {
+		fmt.Fprintf(w, "<p>%s</p>\n", w.inline(text))
+	}
+
+	if literal {
+		for i < len(lines) && lines[i] == "" {
+			i++
+		}
+		if i < len(lines) && indentOf(lines[i]) > 0 {
+			var body []string
+			n := indentOf(lines[i])
+			body, i = block(lines, i, 1)
+			writePre(w, dedent(body, n))
+		}
+	}
+
+	return i
+}
+
+func (w *rstWriter) directive(lines []string, i int) int {
+	m := rstDirective.FindStringSubmatch(lines[i])
+	body, next := block(lines, i+1, 1)
+	body = dedent(body, minIndent(body))
+
+	// Options come first in the body, up to the first blank line.
+	options := map[string]string{}
+	for len(body) > 0 {
+		o := rstField.FindStringSubmatch(body[0])
+		if o == nil {
+			break
+		}
+		options[o[1]] = o[2]
+		body = body[1:]
+	}
+
+	if m == nil {
+		// A comment.
+		return next
+	}
+
+	name, arg := strings.ToLower(m[1]), m[2]
+	switch {
+	case name == "code" || name == "code-block" || name == "sourcecode":
+		writePre(w, trimBlank(body))
+	case name == "image" || name == "figure":
+		fmt.Fprintf(w, `<p><img src="%s" alt="%s"></p>`+"\n",
+			html.EscapeString(arg), html.EscapeString(options["alt"]))
+		if name == "figure" {
+			w.blocks(body)
+		}
+	case rstAdmonitions[name]:
+		fmt.Fprintf(w, "<div class=\"admonition\">\n<p><strong>%s</strong></p>\n", strings.ToUpper(name[:1])+name[1:])
+		if arg != "" {
+			body = append([]string{arg, ""}, body...)
+		}
+		w.blocks(body)
+		w.WriteString("</div>\n")
+	}
+
+	return next
+}
+
+func (w *rstWriter) list(lines []string, i int, marker *regexp.Regexp, tag string) int {
+	fmt.Fprintf(w, "<%s>\n", tag)
+
+	for i < len(lines) {
+		m := marker.FindStringSubmatch(lines[i])
+		if m == nil {
+			break
+		}
+
+		n := len(m[0])
+		first := lines[i][n:]
+		var rest []string
+		rest, i = block(lines, i+1, 1)
+
+		w.WriteString("<li>")
+		item := append([]string{first}, dedent(rest, n)...)
+		if !slices.Contains(item, "") {
+			// Keep simple items compact.
+			w.WriteString(w.inline(strings.Join(item, "\n")))
+		} else {
+			w.blocks(item)
+		}
+		w.WriteString("</li>\n")
+
+		for i < len(lines) && lines[i] == "" {
+			i++
+		}
+	}
+
+	fmt.Fprintf(w, "</%s>\n", tag)
+	return i
+}
+
+func (w *rstWriter) fields(lines []string, i int) int {
+	w.WriteString("<dl>\n")
+	for ; i < len(lines); i++ {
+		m := rstField.FindStringSubmatch(lines[i])
+		if m == nil {
+			break
+		}
+		fmt.Fprintf(w, "<dt>%s</dt><dd>%s</dd>\n", html.EscapeString(m[1]), w.inline(m[2]))
+	}
+	w.WriteString("</dl>\n")
+	return i
+}
+
+func (w *rstWriter) inline(text string) string {
+	return inlineHTML(text, rstInline, func(m []string) string {
+		switch {
+		case m[1] != "":
+			return "<code>" + html.EscapeString(m[1]) + "</code>"
+		case m[2] != "":
+			return link(m[3], html.EscapeString(m[2]))
+		case m[4] != "":
+			if url, ok := w.targets[strings.ToLower(m[4])]; ok {
+				return link(url, html.EscapeString(m[4]))
+			}
+			return html.EscapeString(m[4])
+		case m[5] != "":
+			if m[5] == "code" || m[5] == "literal" {
+				return "<code>" + html.EscapeString(m[6]) + "</code>"
+			}
+			return html.EscapeString(m[6])
+		case m[7] != "":
+			return "<em>" + html.EscapeString(m[7]) + "</em>"
+		case m[8] != "":
+			return "<strong>" + html.EscapeString(m[8]) + "</strong>"
+		case m[9] != "":
+			return "<em>" + html.EscapeString(m[9]) + "</em>"
+		default:
+			return link(m[10], html.EscapeString(m[10]))
+		}
+	})
+}
+
+// link makes a link to url around some already escaped HTML.
+func link(url, inner string) string {
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), inner)
+}
+
+// trimBlank drops leading and trailing blank lines.
+func trimBlank(lines []string) []string {
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
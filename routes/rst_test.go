@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRstHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"title and inline markup",
+			"Title\n=====\n\nSome *em* and **strong** and ``code``.\n",
+			`<h1><a id="title" class="anchor" href="#title">#</a>Title</h1>` + "\n" +
+				"<p>Some <em>em</em> and <strong>strong</strong> and <code>code</code>.</p>\n",
+		},
+		{
+			"bullet list",
+			"- one\n- two\n",
+			"<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n",
+		},
+		{
+			"enumerated list",
+			"1. one\n2. two\n",
+			"<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n",
+		},
+		{
+			"links",
+			"See `Go <https://go.dev>`_ and `docs`_.\n\n.. _docs: https://example.com/docs\n",
+			`<p>See <a href="https://go.dev">Go</a> and <a href="https://example.com/docs">docs</a>.</p>` + "\n",
+		},
+		{
+			"admonition",
+			".. note::\n\n   Careful.\n",
+			"<div class=\"admonition\">\n<p><strong>Note</strong></p>\n<p>Careful.</p>\n</div>\n",
+		},
+		{
+			"code block",
+			".. code-block:: go\n\n   x := 1\n",
+			"<pre><code>x := 1</code></pre>\n",
+		},
+		{
+			"literal block",
+			"::\n\n   literal <b>\n",
+			"<pre><code>literal &lt;b&gt;</code></pre>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rstHTML(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("rstHTML(%q) =\n%s\nwant\n%s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRstNesting(t *testing.T) {
+	// Each deeper indent is another block quote.
+	var lines []string
+	for n := 0; n < 2*maxNesting; n++ {
+		lines = append(lines, strings.Repeat(" ", n)+"quote", "")
+	}
+	if _, err := rstHTML(strings.Join(lines, "\n")); err != nil {
+		t.Fatal(err)
+	}
+}
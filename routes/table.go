@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// tableRows is how many rows of a CSV or TSV file are shown per page.
+const tableRows = 100
+
+// table is one page of a delimited data file.
+type table struct {
+	Header []string
+	Rows   []tableRow
+	Total  int
+	Page   int
+	Pages  int
+	// Prev and Next are the neighbouring pages, or 0 at either end.
+	Prev int
+	Next int
+}
+
+type tableRow struct {
+	// N counts rows from 1, not counting the header.
+	N     int
+	Cells []string
+}
+
+func isTable(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv", ".tsv":
+		return true
+	}
+	return false
+}
+
+// readTable parses content as CSV, or TSV going by name, and returns the
+// given page of it, counting from 1.
+func readTable(name, content string, page int) (*table, error) {
+	r := csv.NewReader(strings.NewReader(content))
+	if strings.ToLower(path.Ext(name)) == ".tsv" {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var records [][]string
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+
+	t := &table{}
+	if looksLikeHeader(records) {
+		t.Header, records = records[0], records[1:]
+	}
+
+	t.Total = len(records)
+	t.Pages = max((len(records)+tableRows-1)/tableRows, 1)
+	t.Page = min(max(page, 1), t.Pages)
+
+	if t.Page > 1 {
+		t.Prev = t.Page - 1
+	}
+	if t.Page < t.Pages {
+		t.Next = t.Page + 1
+	}
+
+	start := (t.Page - 1) * tableRows
+	rows := records[start:min(start+tableRows, len(records))]
+
+	// Pad ragged rows so the columns line up.
+	cols := len(t.Header)
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	if t.Header != nil {
+		t.Header = pad(t.Header, cols)
+	}
+	for i, row := range rows {
+		t.Rows = append(t.Rows, tableRow{N: start + i + 1, Cells: pad(row, cols)})
+	}
+
+	return t, nil
+}
+
+func pad(row []string, n int) []string {
+	for len(row) < n {
+		row = append(row, "")
+	}
+	return row
+}
+
+// looksLikeHeader guesses whether the first record names the columns: it
+// has to be all distinct, non-empty, non-numeric labels, and not the only
+// record.
+func looksLikeHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return false
+	}
+
+	seen := map[string]bool{}
+	for _, c := range records[0] {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[c] {
+			return false
+		}
+		if _, err := strconv.ParseFloat(c, 64); err == nil {
+			return false
+		}
+		seen[c] = true
+	}
+	return true
+}
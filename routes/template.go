@@ -2,17 +2,25 @@ package routes
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"git.icyphox.sh/legit/git"
 	"github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/dustin/go-humanize"
+	"github.com/microcosm-cc/bluemonday"
 )
 
 func (d *deps) Write404(w http.ResponseWriter) {
@@ -46,6 +54,17 @@ func (d *deps) listFiles(files []git.NiceTree, data map[string]any, w http.Respo
 	}
 }
 
+// redirectSubmodule sends requests for a submodule path on to wherever the
+// submodule lives, since there's nothing of it in this repo to show.
+func (d *deps) redirectSubmodule(w http.ResponseWriter, r *http.Request, name string, sm *git.Submodule) {
+	link := d.submoduleLink(name, sm)
+	if link == "" {
+		d.Write404(w)
+		return
+	}
+	http.Redirect(w, r, link, http.StatusFound)
+}
+
 func countLines(r io.Reader) (int, error) {
 	buf := make([]byte, 32*1024)
 	bufLen := 0
@@ -72,6 +91,29 @@ func countLines(r io.Reader) (int, error) {
 	}
 }
 
+// firstLines returns the first n lines of content.
+func firstLines(content string, n int) string {
+	i := 0
+	for ; n > 0; n-- {
+		j := strings.IndexByte(content[i:], '\n')
+		if j < 0 {
+			return content
+		}
+		i += j + 1
+	}
+	return content[:i]
+}
+
+// isMinified guesses whether content is minified code from its average
+// line length; hand-written code rarely averages more than a few dozen
+// characters a line.
+func isMinified(content string, lines int) bool {
+	if lines == 0 || len(content) < 4096 {
+		return false
+	}
+	return len(content)/lines > 500
+}
+
 func (d *deps) showFileWithHighlight(name, content string, data map[string]any, w http.ResponseWriter) {
 	tpath := filepath.Join(d.c.Dirs.Templates, "*")
 	t := template.Must(template.ParseGlob(tpath))
@@ -114,6 +156,40 @@ func (d *deps) showFileWithHighlight(name, content string, data map[string]any,
 	}
 }
 
+// showDocument shows a file rendered as a document, a table or a
+// notebook, rather than as code. It reports whether it managed to.
+func (d *deps) showDocument(r *http.Request, name, ref, p, content string, data map[string]any, w http.ResponseWriter) bool {
+	var err error
+	switch {
+	case isTable(p):
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		data["table"], err = readTable(p, content, page)
+	case isNotebook(p):
+		data["notebook"], err = d.readNotebook(name, ref, p, content)
+	default:
+		html, ok := d.renderFile(name, ref, p, content)
+		if !ok {
+			return false
+		}
+		data["rendered"] = html
+	}
+	if err != nil {
+		log.Printf("rendering %s: %s", p, err)
+		return false
+	}
+
+	tpath := filepath.Join(d.c.Dirs.Templates, "*")
+	t := template.Must(template.ParseGlob(tpath))
+
+	data["markup"] = true
+	data["meta"] = d.c.Meta
+
+	if err := t.ExecuteTemplate(w, "file", data); err != nil {
+		log.Println(err)
+	}
+	return true
+}
+
 func (d *deps) showFile(content string, data map[string]any, w http.ResponseWriter) {
 	tpath := filepath.Join(d.c.Dirs.Templates, "*")
 	t := template.Must(template.ParseGlob(tpath))
@@ -142,9 +218,125 @@ func (d *deps) showFile(content string, data map[string]any, w http.ResponseWrit
 	}
 }
 
-func (d *deps) showRaw(content string, w http.ResponseWriter) {
+// showMedia renders the file template with an inline preview of an image,
+// video, audio or PDF file, pointing at the raw endpoint.
+func (d *deps) showMedia(gr *git.GitRepo, kind, path string, data map[string]any, w http.ResponseWriter) {
+	tpath := filepath.Join(d.c.Dirs.Templates, "*")
+	t := template.Must(template.ParseGlob(tpath))
+
+	file, err := gr.File(path)
+	if err != nil {
+		d.Write500(w)
+		log.Println(err)
+		return
+	}
+
+	data["media"] = kind
+	data["raw"] = fmt.Sprintf("/%s/raw/%s/%s", data["name"], data["ref"], path)
+	data["size"] = humanize.IBytes(uint64(file.Size))
+	if kind == "image" {
+		if width, height, ok := imageSize(file); ok {
+			data["width"] = width
+			data["height"] = height
+		}
+	}
+	data["meta"] = d.c.Meta
+
+	if err := t.ExecuteTemplate(w, "file", data); err != nil {
+		log.Println(err)
+		return
+	}
+}
+
+// writePatch serves ref as plain text: a format-patch mbox when asDiff is
+// unset, a unified diff otherwise. A non-empty base turns it into a range.
+func (d *deps) writePatch(w http.ResponseWriter, path, ref, base string, asDiff, mergeBase bool) {
+	gr, err := git.Open(path, ref)
+	if err != nil {
+		d.Write404(w)
+		return
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case base == "" && asDiff:
+		err = gr.WriteDiff(&buf)
+	case base == "":
+		err = gr.WritePatch(&buf)
+	case asDiff:
+		err = gr.WriteRangeDiff(&buf, base, mergeBase)
+	default:
+		err = gr.WriteRangePatch(&buf, base)
+	}
+	if err != nil {
+		log.Println(err)
+		d.Write404(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "text/plain")
-	w.Write([]byte(content))
-	return
+	w.Write(buf.Bytes())
+}
+
+// findReadme renders the first of the configured readme files found in
+// dir, if any.
+func (d *deps) findReadme(gr *git.GitRepo, name, ref, dir string) template.HTML {
+	for _, readme := range d.c.Repo.Readme {
+		p := path.Join(dir, readme)
+		content, _ := gr.FileContent(p)
+		if len(content) == 0 {
+			continue
+		}
+
+		if html, ok := d.renderFile(name, ref, p, content); ok {
+			return html
+		}
+		safe := bluemonday.UGCPolicy().SanitizeBytes([]byte(content))
+		return template.HTML(fmt.Sprintf(`<pre>%s</pre>`, safe))
+	}
+	return ""
+}
+
+// writeArchive writes the tree at gr's ref as a gzipped tarball, with
+// every path under prefix.
+func writeArchive(w io.Writer, gr *git.GitRepo, prefix string) error {
+	gw := gzip.NewWriter(w)
+	defer gw.Close()
+
+	if err := gr.WriteTar(gw, prefix); err != nil {
+		return err
+	}
+
+	return gw.Flush()
+}
+
+// archiveKey is what archive checksums are cached under. Archives are
+// reproducible, so one commit's is always the same.
+func archiveKey(prefix, commit string) string {
+	return prefix + "@" + commit
+}
+
+// cachedChecksum returns the SHA-256 of the archive for commit if it's
+// already been worked out, or "".
+func (d *deps) cachedChecksum(prefix, commit string) string {
+	sum, _ := d.sums.Get(archiveKey(prefix, commit))
+	return sum
+}
+
+// archiveChecksum returns the SHA-256 of the archive Archive would serve
+// for gr, building it if it isn't cached.
+func (d *deps) archiveChecksum(gr *git.GitRepo, prefix, commit string) (string, error) {
+	if sum := d.cachedChecksum(prefix, commit); sum != "" {
+		return sum, nil
+	}
+
+	h := sha256.New()
+	if err := writeArchive(h, gr, prefix); err != nil {
+		return "", err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	d.sums.Add(archiveKey(prefix, commit), sum)
+	return sum, nil
 }
@@ -3,12 +3,17 @@ package routes
 import (
 	"io/fs"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"git.icyphox.sh/legit/git"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 func isGoModule(gr *git.GitRepo) bool {
@@ -16,6 +21,41 @@ func isGoModule(gr *git.GitRepo) bool {
 	return err == nil
 }
 
+// languages returns the language breakdown of the repo at path, on
+// branch.
+func (d *deps) languages(path, branch string) ([]git.Language, error) {
+	gr, err := git.Open(path, branch)
+	if err != nil {
+		return nil, err
+	}
+	return gr.Languages()
+}
+
+// cachedLanguages is languages, but only if the breakdown is cached.
+func (d *deps) cachedLanguages(path, branch string) ([]git.Language, bool) {
+	gr, err := git.Open(path, branch)
+	if err != nil {
+		return nil, false
+	}
+	return gr.CachedLanguages()
+}
+
+// authors maps commits' hashes to their authors, as the repo's .mailmap
+// has them. The commits themselves aren't touched, since their signatures
+// cover the original authors.
+func authors(gr *git.GitRepo, commits []*object.Commit) map[string]object.Signature {
+	mm, err := gr.Mailmap()
+	if err != nil {
+		log.Println(err)
+	}
+
+	m := make(map[string]object.Signature, len(commits))
+	for _, c := range commits {
+		m[c.Hash.String()] = mm.Map(c.Author)
+	}
+	return m
+}
+
 func getDisplayName(name string) string {
 	return strings.TrimSuffix(name, ".git")
 }
@@ -104,9 +144,130 @@ func (d *deps) category(path string) string {
 	return strings.TrimPrefix(filepath.Dir(strings.TrimPrefix(path, d.c.Repo.ScanPath)), string(os.PathSeparator))
 }
 
-func setContentDisposition(w http.ResponseWriter, name string) {
-	h := "inline; filename=\"" + name + "\""
-	w.Header().Add("Content-Disposition", h)
+// submoduleLink returns where a submodule of repo name should link to:
+// the pinned commit of the local repo if its URL points at this server,
+// or a browsable form of the upstream URL otherwise.
+func (d *deps) submoduleLink(name string, sm *git.Submodule) string {
+	var host, p string
+
+	switch {
+	case sm.URL == "":
+		return ""
+	case strings.HasPrefix(sm.URL, "./") || strings.HasPrefix(sm.URL, "../"):
+		// Relative to the superproject's own URL.
+		host = d.c.Server.Name
+		p = path.Join("/", name, sm.URL)
+	case !strings.Contains(sm.URL, "://"):
+		// scp-like syntax, user@host:path.
+		h, rest, ok := strings.Cut(sm.URL, ":")
+		if !ok {
+			return ""
+		}
+		_, host, _ = strings.Cut(h, "@")
+		if host == "" {
+			host = h
+		}
+		p = "/" + strings.TrimPrefix(rest, "/")
+	default:
+		u, err := url.Parse(sm.URL)
+		if err != nil {
+			return ""
+		}
+		host = u.Hostname()
+		p = u.Path
+
+		// Web URLs are browsable as they are, on whatever scheme and
+		// port they use; only ssh:// and git:// need rewriting.
+		if host != d.c.Server.Name && (u.Scheme == "http" || u.Scheme == "https") {
+			u.User = nil
+			return u.String()
+		}
+	}
+
+	if host == d.c.Server.Name {
+		return path.Join(p, "tree", sm.Commit) + "/"
+	}
+
+	return "https://" + host + p
+}
+
+// sniffContentType picks a Content-Type for a blob from its first bytes,
+// falling back to the file extension when sniffing finds nothing more
+// specific than plain text or binary.
+func sniffContentType(name string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	switch sniffed {
+	case "application/octet-stream", "text/plain; charset=utf-8", "text/xml; charset=utf-8":
+		if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+			// Source files are best shown as text, whatever the
+			// system MIME table says.
+			if strings.HasPrefix(sniffed, "text/plain") && !strings.HasPrefix(t, "image/") {
+				return sniffed
+			}
+			return t
+		}
+	}
+	return sniffed
+}
+
+// isAttachment reports whether raw blobs of ctype must be downloaded
+// rather than shown inline, per the raw.attachment config.
+func (d *deps) isAttachment(ctype string) bool {
+	mt, _, _ := strings.Cut(ctype, ";")
+	for _, a := range d.c.Raw.Attachment {
+		if strings.EqualFold(strings.TrimSpace(mt), a) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange parses a single-range Range header against a blob of size
+// bytes, returning where to start and how much to send. Multiple ranges
+// aren't supported and get the whole blob.
+func parseRange(h string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(h, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		// bytes=-n, the last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		n = min(n, size)
+		return size - n, n, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+
+	return start, end - start + 1, true
+}
+
+// setContentDisposition sets a Content-Disposition of kind, "inline" or
+// "attachment", with name quoted or encoded as it needs to be.
+func setContentDisposition(w http.ResponseWriter, kind, name string) {
+	h := mime.FormatMediaType(kind, map[string]string{"filename": name})
+	w.Header().Set("Content-Disposition", h)
 }
 
 func setGZipMIME(w http.ResponseWriter) {